@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/middleware"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+	"github.com/gorilla/mux"
+)
+
+// migratePostKeysTask moves the posts stored at the root under their author
+const migratePostKeysTask = "migratePostKeys"
+
+// migrationBatches is the number of batches a migratePostKeys task runs before it enqueues its continuation
+const migrationBatches = 10
+
+// postKeyMigrator is implemented by the datastore backends, whose posts changed key layout
+type postKeyMigrator interface {
+	MigratePostKeys(ctx context.Context, start string, limit int) (string, bool, error)
+}
+
+func init() {
+	tasks.Register(migratePostKeysTask, migratePostKeys)
+	muxRouter.HandleFunc("/admin/tasks/{name}", adminTaskHandler).Methods(http.MethodPost)
+	muxRouter.HandleFunc("/admin/persisted-queries", adminManifestHandler).Methods(http.MethodPost)
+}
+
+// migratePostKeys migrates a few batches of posts from the cursor start, then
+// enqueues itself to carry on where it stopped
+func migratePostKeys(ctx context.Context, start string) error {
+	migrator, ok := store.FromContext(ctx).(postKeyMigrator)
+	if !ok {
+		return nil // the other backends have no key layout to migrate
+	}
+	for batch := 0; batch < migrationBatches; batch++ {
+		end, done, err := migrator.MigratePostKeys(ctx, start, 100)
+		if err != nil {
+			return err
+		}
+		if done {
+			log.Printf("%s: every post is stored under its author", migratePostKeysTask)
+			return nil
+		}
+		start = end
+	}
+	return tasks.FromContext(ctx).Enqueue(ctx, migratePostKeysTask, start)
+}
+
+// adminViewer returns the admin making r, or responds with an error when r is not made by an admin
+func adminViewer(w http.ResponseWriter, r *http.Request, action string) (auth.Viewer, bool) {
+	viewer, err := tokenSigner.ViewerFromRequest(r)
+	if err != nil || !viewer.Authenticated() {
+		middleware.ResponseError(w, "Invalid, expired or missing token", http.StatusUnauthorized)
+		return viewer, false
+	}
+	if !viewer.Admin {
+		middleware.ResponseError(w, "Only admins can "+action, http.StatusForbidden)
+		return viewer, false
+	}
+	return viewer, true
+}
+
+// adminTaskHandler enqueues the background task named in the path, for admins only
+func adminTaskHandler(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := adminViewer(w, r, "run tasks")
+	if !ok {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if !tasks.Registered(name) {
+		middleware.ResponseError(w, "Unknown task "+name, http.StatusNotFound)
+		return
+	}
+	ctx := auth.NewContext(dataBackend.requestContext(r), viewer)
+	if err := tasks.FromContext(ctx).Enqueue(ctx, name, r.FormValue("arg")); err != nil {
+		log.Printf("Failed to enqueue %s: %v", name, err)
+		middleware.ResponseError(w, "Failed to enqueue "+name, http.StatusInternalServerError)
+		return
+	}
+	middleware.ResponseJSON(w, map[string]string{"enqueued": name})
+}
+
+// adminManifestHandler adds the operations of the manifest in the request body to the allowlist, for admins only
+func adminManifestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := adminViewer(w, r, "register operations"); !ok {
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxManifestSize))
+	if err != nil {
+		middleware.ResponseError(w, "Invalid or too large request body", http.StatusBadRequest)
+		return
+	}
+	queries, err := persisted.ParseManifest(body)
+	if err != nil {
+		middleware.ResponseError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := dataBackend.requestContext(r)
+	if err := registerOperations(ctx, queries); err != nil {
+		log.Printf("Failed to register operations: %v", err)
+		middleware.ResponseError(w, "Failed to register operations", http.StatusInternalServerError)
+		return
+	}
+	middleware.ResponseJSON(w, map[string]int{"registered": len(queries)})
+}
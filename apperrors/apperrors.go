@@ -0,0 +1,100 @@
+package apperrors
+
+import (
+	"fmt"
+)
+
+// Code classifies an error so clients can branch on it without parsing messages
+type Code string
+
+// Error codes surfaced to clients as `extensions.code`
+const (
+	BadRequest      Code = "BAD_REQUEST"
+	NotFound        Code = "NOT_FOUND"
+	InvalidArgument Code = "INVALID_ARGUMENT"
+	Unauthenticated Code = "UNAUTHENTICATED"
+	Forbidden       Code = "FORBIDDEN"
+	Internal        Code = "INTERNAL"
+
+	PersistedQueryNotFound Code = "PERSISTED_QUERY_NOT_FOUND" // the client should send the query along with its hash
+	QueryTooComplex        Code = "QUERY_TOO_COMPLEX"         // the operation is nested too deep or costs too much to run
+)
+
+// internalMessage is shown to clients in place of the details of an internal error
+const internalMessage = "Internal server error"
+
+// Error is an error carrying a Code, it implements gqlerrors.ExtendedError
+type Error struct {
+	Code    Code
+	Message string
+	Field   string // argument the error is about, mutations report such errors as user errors
+	Err     error  // underlying error, never shown to clients
+}
+
+// Error function
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Cause returns the underlying error, for use with github.com/pkg/errors
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Extensions returns the entries of the `extensions` member of a GraphQL error
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+// OnField returns a copy of e about the given argument
+func (e *Error) OnField(field string) *Error {
+	copied := *e
+	copied.Field = field
+	return &copied
+}
+
+// New returns an Error with the given code and message
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf returns an Error with the given code and formatted message
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// NotFoundf returns a NotFound error
+func NotFoundf(format string, args ...interface{}) *Error {
+	return Newf(NotFound, format, args...)
+}
+
+// InvalidArgumentf returns an InvalidArgument error
+func InvalidArgumentf(format string, args ...interface{}) *Error {
+	return Newf(InvalidArgument, format, args...)
+}
+
+// Unauthenticatedf returns an Unauthenticated error
+func Unauthenticatedf(format string, args ...interface{}) *Error {
+	return Newf(Unauthenticated, format, args...)
+}
+
+// Forbiddenf returns a Forbidden error
+func Forbiddenf(format string, args ...interface{}) *Error {
+	return Newf(Forbidden, format, args...)
+}
+
+// InternalError wraps an unexpected error, hiding its details from clients
+func InternalError(err error) *Error {
+	if appErr, ok := err.(*Error); ok {
+		return appErr
+	}
+	return &Error{Code: Internal, Message: internalMessage, Err: err}
+}
+
+// CodeOf returns the Code of err, or Internal when err carries none
+func CodeOf(err error) Code {
+	if appErr, ok := err.(*Error); ok {
+		return appErr.Code
+	}
+	return Internal
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for bearer tokens that are malformed, forged or expired
+var ErrInvalidToken = errors.New("auth: invalid or expired token")
+
+// Viewer is the identity a request acts on behalf of
+type Viewer struct {
+	UserID string // empty for anonymous requests
+	Admin  bool   // may change content of any user
+}
+
+// Authenticated reports whether the request carried a valid token
+func (v Viewer) Authenticated() bool {
+	return v.UserID != "" || v.Admin
+}
+
+// CanEdit reports whether v may change content owned by userID
+func (v Viewer) CanEdit(userID string) bool {
+	return v.Admin || v.UserID != "" && v.UserID == userID
+}
+
+type contextKey struct{}
+
+type signerKey struct{}
+
+// NewContext returns a copy of ctx carrying v
+func NewContext(ctx context.Context, v Viewer) context.Context {
+	return context.WithValue(ctx, contextKey{}, v)
+}
+
+// FromContext returns the Viewer carried by ctx, anonymous when there is none
+func FromContext(ctx context.Context) Viewer {
+	v, _ := ctx.Value(contextKey{}).(Viewer)
+	return v
+}
+
+// NewSignerContext returns a copy of ctx carrying s, which issues the tokens of new users
+func NewSignerContext(ctx context.Context, s *Signer) context.Context {
+	return context.WithValue(ctx, signerKey{}, s)
+}
+
+// SignerFromContext returns the Signer carried by ctx, nil when the server signs no tokens
+func SignerFromContext(ctx context.Context) *Signer {
+	s, _ := ctx.Value(signerKey{}).(*Signer)
+	return s
+}
+
+// claims is the payload of a token
+type claims struct {
+	UserID  string `json:"sub,omitempty"`
+	Admin   bool   `json:"adm,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+// Signer issues and verifies bearer tokens, an HMAC-SHA256 signed payload
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner function
+func NewSigner(secret []byte) *Signer {
+	return &Signer{secret: secret}
+}
+
+// sign returns the signature of payload
+func (s *Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns a token identifying v until it expires
+func (s *Signer) Sign(v Viewer, expires time.Time) string {
+	raw, _ := json.Marshal(claims{UserID: v.UserID, Admin: v.Admin, Expires: expires.Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + s.sign(payload)
+}
+
+// Verify returns the Viewer identified by token
+func (s *Signer) Verify(token string, now time.Time) (Viewer, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(s.sign(parts[0]))) {
+		return Viewer{}, ErrInvalidToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Viewer{}, ErrInvalidToken
+	}
+	var c claims
+	if err := json.Unmarshal(raw, &c); err != nil || now.Unix() >= c.Expires {
+		return Viewer{}, ErrInvalidToken
+	}
+	return Viewer{UserID: c.UserID, Admin: c.Admin}, nil
+}
+
+// ViewerFromRequest reads the `Authorization: Bearer` token of r, requests
+// without one are anonymous. A nil Signer rejects every token.
+func (s *Signer) ViewerFromRequest(r *http.Request) (Viewer, error) {
+	return s.ViewerFromAuthorization(r.Header.Get("Authorization"))
+}
+
+// ViewerFromAuthorization reads a `Bearer` token from the value of an Authorization
+// header, or of the same field sent another way, an empty value is anonymous
+func (s *Signer) ViewerFromAuthorization(header string) (Viewer, error) {
+	if header == "" {
+		return Viewer{}, nil
+	}
+	const prefix = "Bearer "
+	if s == nil || len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return Viewer{}, ErrInvalidToken
+	}
+	return s.Verify(strings.TrimSpace(header[len(prefix):]), time.Now())
+}
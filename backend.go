@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted/aepersisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted/mempersisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/resolvers"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/aesearch"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/memsearch"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/aedatastore"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/memstore"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks/aetasks"
+	"github.com/pkg/errors"
+	"google.golang.org/appengine"
+)
+
+// backend is a storage implementation along with the request context it expects,
+// the queue running background work against it, the index searching its posts,
+// the broker announcing their changes, and the stores of the queries persisted
+// by clients and of those allowed by the registered manifests
+type backend struct {
+	store      store.Store
+	tasks      tasks.Queue
+	search     search.Index
+	broker     pubsub.Broker
+	queries    persisted.Store
+	allowlist  persisted.Store
+	newContext func(r *http.Request) context.Context
+	appEngine  bool // served by appengine.Main on the legacy runtime
+}
+
+// backendFactories maps STORE_BACKEND values onto their constructors, backends
+// with extra dependencies register themselves from files behind build tags
+var backendFactories = map[string]func() (backend, error){
+	"datastore": newAppEngineBackend,
+	"memory":    newMemoryBackend,
+}
+
+// brokerFactories maps PUBSUB_BROKER values onto the brokers that override the
+// in-process one of the backend, brokers backed by a shared bus register
+// themselves from files behind build tags
+var brokerFactories = map[string]func() (pubsub.Broker, error){
+	"local": func() (pubsub.Broker, error) { return pubsub.NewLocal(), nil },
+}
+
+// requestContext returns the request context, carrying the store, task queue, search index and broker
+func (b backend) requestContext(r *http.Request) context.Context {
+	return b.withServices(b.newContext(r))
+}
+
+// withServices returns a copy of ctx carrying the store, task queue, search index and broker
+func (b backend) withServices(ctx context.Context) context.Context {
+	ctx = search.NewContext(tasks.NewContext(store.NewContext(ctx, b.store), b.tasks), b.search)
+	return pubsub.NewContext(ctx, b.broker)
+}
+
+// reindexInProcess rebuilds a search index kept in process, which starts empty
+// while the store may already hold posts
+func (b backend) reindexInProcess() error {
+	if _, ok := b.search.(*memsearch.Index); !ok {
+		return nil
+	}
+	ctx := b.withServices(context.Background())
+	return tasks.FromContext(ctx).Enqueue(ctx, resolvers.ReindexPostsTask, "")
+}
+
+// newBackend selects the storage implementation named by the STORE_BACKEND environment
+// variable, and the broker named by PUBSUB_BROKER when it is set
+func newBackend() (backend, error) {
+	name := os.Getenv("STORE_BACKEND")
+	if name == "" {
+		name = "datastore"
+	}
+	factory, ok := backendFactories[name]
+	if !ok {
+		return backend{}, errors.Errorf("Unknown STORE_BACKEND %q", name)
+	}
+	b, err := factory()
+	if err != nil {
+		return b, err
+	}
+	if brokerName := os.Getenv("PUBSUB_BROKER"); brokerName != "" {
+		newBroker, ok := brokerFactories[brokerName]
+		if !ok {
+			return backend{}, errors.Errorf("Unknown PUBSUB_BROKER %q", brokerName)
+		}
+		if b.broker, err = newBroker(); err != nil {
+			return backend{}, err
+		}
+	}
+	return b, nil
+}
+
+// newAppEngineBackend uses the App Engine datastore, the default
+func newAppEngineBackend() (backend, error) {
+	return backend{store: aedatastore.New(), tasks: aetasks.New(), search: aesearch.New(), broker: pubsub.NewLocal(), queries: aepersisted.New("PersistedQuery"), allowlist: aepersisted.New("AllowedQuery"), newContext: appengine.NewContext, appEngine: true}, nil
+}
+
+// newMemoryBackend keeps everything in process, for local development
+func newMemoryBackend() (backend, error) {
+	return backend{store: memstore.New(), tasks: tasks.Local{}, search: memsearch.New(), broker: pubsub.NewLocal(), queries: mempersisted.New(), allowlist: mempersisted.New(), newContext: requestContext}, nil
+}
+
+// requestContext function
+func requestContext(r *http.Request) context.Context {
+	return r.Context()
+}
@@ -0,0 +1,45 @@
+//go:build clouddatastore
+// +build clouddatastore
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted/cloudpersisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/memsearch"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/clouddatastore"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	backendFactories["clouddatastore"] = newCloudDatastoreBackend
+}
+
+// newCloudDatastoreBackend uses the standalone Cloud Datastore client, so the
+// server runs on newer runtimes, Cloud Run or a plain VM. The project is read
+// from DATASTORE_PROJECT_ID or GOOGLE_CLOUD_PROJECT, and DATASTORE_EMULATOR_HOST
+// points the client at a local emulator. Posts are searched in an index kept by
+// each server, which only sees its own writes, so the backend supports a single
+// instance and refuses to start until SEARCH_INDEX=local confirms the deployment
+// runs one.
+func newCloudDatastoreBackend() (backend, error) {
+	if os.Getenv("SEARCH_INDEX") != "local" {
+		return backend{}, errors.New("The clouddatastore backend searches posts in process and supports a single instance, set SEARCH_INDEX=local once the deployment runs at most one")
+	}
+	projectID := os.Getenv("DATASTORE_PROJECT_ID")
+	if projectID == "" {
+		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if projectID == "" {
+		return backend{}, errors.New("DATASTORE_PROJECT_ID or GOOGLE_CLOUD_PROJECT must be set")
+	}
+	s, err := clouddatastore.New(context.Background(), projectID)
+	if err != nil {
+		return backend{}, errors.Wrap(err, "Failed to create a Cloud Datastore client")
+	}
+	return backend{store: s, tasks: tasks.Local{}, search: memsearch.New(), broker: pubsub.NewLocal(), queries: cloudpersisted.New(s.Client(), "PersistedQuery"), allowlist: cloudpersisted.New(s.Client(), "AllowedQuery"), newContext: requestContext}, nil
+}
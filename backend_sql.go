@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted/sqlpersisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/sqlsearch"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore"
+	_ "github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore/drivers" // drivers selected with build tags
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	backendFactories["sql"] = newSQLBackend
+}
+
+// newSQLBackend uses PostgreSQL or SQLite, named by SQL_DRIVER and reached at SQL_DSN.
+// The schema is created beforehand with cmd/migrate, and posts are searched in the
+// database so that any number of servers may share it.
+func newSQLBackend() (backend, error) {
+	driver, dsn := os.Getenv("SQL_DRIVER"), os.Getenv("SQL_DSN")
+	dialect, err := sqlstore.DialectForDriver(driver)
+	if err != nil {
+		return backend{}, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return backend{}, errors.Wrapf(err, "Failed to open the %s database, is the driver built in?", driver)
+	}
+	if err := db.Ping(); err != nil {
+		return backend{}, errors.Wrapf(err, "Failed to connect to the %s database", driver)
+	}
+	return backend{store: sqlstore.New(db, dialect), tasks: tasks.Local{}, search: sqlsearch.New(db, dialect), broker: pubsub.NewLocal(), queries: sqlpersisted.New(db, dialect, "persisted_queries"), allowlist: sqlpersisted.New(db, dialect, "allowed_queries"), newContext: requestContext}, nil
+}
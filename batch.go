@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/complexity"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/middleware"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// serveBatch runs the operations of a batch concurrently and writes the array of their results, in
+// the order of the operations. They share the loaders and the viewer of ctx, and each result carries
+// its own errors, so the batch is answered with 200 unless it holds too many operations, or their
+// costs add up to more than the limit of a single operation.
+func serveBatch(ctx context.Context, w http.ResponseWriter, requests []middleware.GraphQLRequest) {
+	if maxBatchSize > 0 && len(requests) > maxBatchSize {
+		middleware.ResponseError(w, fmt.Sprintf("A batch may hold at most %d operations", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	// admit and measure every operation before any of them runs
+	results := make([]*graphql.Result, len(requests))
+	measures := make([]complexity.Measure, len(requests))
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := admitRequest(ctx, &requests[i]); err != nil {
+				_, formatted := admissionError(err)
+				results[i] = &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}}
+				return
+			}
+			_, measures[i], results[i] = parseOperation(requests[i])
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for i, measure := range measures {
+		if results[i] == nil {
+			total += measure.Cost
+		}
+	}
+	if maxQueryCost > 0 && total > maxQueryCost {
+		formatted := gqlerrors.NewFormattedError(fmt.Sprintf("The operations of the batch cost %d, more than the limit of %d", total, maxQueryCost))
+		formatted.Extensions = map[string]interface{}{"code": apperrors.QueryTooComplex}
+		for key, value := range complexityExtensions(complexity.Measure{Cost: total}) {
+			formatted.Extensions[key] = value
+		}
+		middleware.ResponseFormattedError(w, formatted, http.StatusBadRequest)
+		return
+	}
+
+	for i := range requests {
+		if results[i] != nil { // turned down, or failing to parse, validate or pass the limits
+			middleware.FormatResult(results[i])
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runOperation(ctx, requests[i], measures[i])
+			middleware.FormatResult(results[i])
+		}(i)
+	}
+	wg.Wait()
+	middleware.ResponseJSON(w, results)
+}
@@ -0,0 +1,68 @@
+// Command allowlist uploads a persisted query manifest from a frontend build to the
+// GraphQL server, whose QUERY_ALLOWLIST mode then lets its operations run.
+//
+//	AUTH_TOKEN=$(AUTH_SECRET=... go run ./cmd/token -admin) go run ./cmd/allowlist -server https://graphqlserver-259904.appspot.com persisted-query-manifest.json
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "base URL of the GraphQL server")
+	token := flag.String("token", os.Getenv("AUTH_TOKEN"), "admin bearer token, issued with cmd/token")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: allowlist [flags] manifest.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *token == "" {
+		log.Fatal("-token or AUTH_TOKEN is required")
+	}
+	if err := upload(*server, *token, flag.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// upload checks the manifest at path, and registers its operations with the server
+func upload(server, token, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	queries, err := persisted.ParseManifest(data) // fail before uploading anything
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(server, "/")+"/admin/persisted-queries", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to upload the manifest")
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Failed to upload the manifest: %s %s", resp.Status, body)
+	}
+	fmt.Printf("registered %d operations\n", len(queries))
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build clouddatastore
+// +build clouddatastore
+
+package main
+
+import (
+	"context"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/clouddatastore"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	openers["clouddatastore"] = openCloudDatastore
+}
+
+// openCloudDatastore connects to the datastore of a project, DATASTORE_EMULATOR_HOST is honoured.
+// The posts are searched in the process of each clouddatastore server, which rebuilds its index
+// as it starts, or with the App Engine search API, neither of which the command reaches.
+func openCloudDatastore(ctx context.Context, opts options) (store.Store, search.Index, error) {
+	if opts.project == "" {
+		return nil, nil, errors.New("-project or DATASTORE_PROJECT_ID must be set")
+	}
+	s, err := clouddatastore.New(ctx, opts.project)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to create a Cloud Datastore client")
+	}
+	return s, nil, nil
+}
@@ -0,0 +1,87 @@
+// Command checkposts reports posts whose author does not exist, and deletes
+// them with -repair, from the store and from the search index when it can reach
+// it. Posts stored by the App Engine backend are reached with the clouddatastore
+// backend, which reads the same entities.
+//
+//	go run -tags sqlite ./cmd/checkposts -backend sql -driver sqlite3 -dsn graphql.db
+//	go run -tags clouddatastore ./cmd/checkposts -backend clouddatastore -project graphqlserver-259904 -repair
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/consistency"
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/sqlsearch"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore"
+	_ "github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore/drivers" // drivers selected with build tags
+	"github.com/pkg/errors"
+)
+
+// options holds the flags that select and reach a store
+type options struct {
+	driver  string
+	dsn     string
+	project string
+}
+
+// openers maps -backend values onto their constructors, which return the store and its
+// search index, nil when the command cannot reach it. Backends with extra dependencies
+// register themselves from files behind build tags.
+var openers = map[string]func(ctx context.Context, opts options) (store.Store, search.Index, error){
+	"sql": openSQL,
+}
+
+func main() {
+	var opts options
+	backend := flag.String("backend", "sql", "store holding the posts: sql or clouddatastore")
+	flag.StringVar(&opts.driver, "driver", os.Getenv("SQL_DRIVER"), "database/sql driver of the sql backend: postgres or sqlite3")
+	flag.StringVar(&opts.dsn, "dsn", os.Getenv("SQL_DSN"), "data source name of the sql backend")
+	flag.StringVar(&opts.project, "project", os.Getenv("DATASTORE_PROJECT_ID"), "project of the clouddatastore backend")
+	repair := flag.Bool("repair", false, "delete the orphaned posts instead of only reporting them")
+	flag.Parse()
+
+	ctx := context.Background()
+	open, ok := openers[*backend]
+	if !ok {
+		log.Fatalf("Unknown backend %q, is it built in?", *backend)
+	}
+	s, x, err := open(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := consistency.CheckPosts(ctx, s, x, *repair, func(post m.Post) {
+		fmt.Printf("post %s: user %q does not exist\n", post.ID, post.UserID)
+	})
+	fmt.Printf("checked %d posts, %d orphaned, %d deleted\n", report.Checked, report.Orphans, report.Repaired)
+	if x == nil && report.Repaired > 0 {
+		fmt.Println("the search index of the servers is out of reach, searchPosts skips the deleted posts until it drops them")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openSQL opens the database of the sql backend, which is searched directly
+func openSQL(ctx context.Context, opts options) (store.Store, search.Index, error) {
+	dialect, err := sqlstore.DialectForDriver(opts.driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sql.Open(opts.driver, opts.dsn)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to open the %s database, is the driver built in?", opts.driver)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to connect to the %s database", opts.driver)
+	}
+	return sqlstore.New(db, dialect), sqlsearch.New(db, dialect), nil
+}
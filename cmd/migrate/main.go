@@ -0,0 +1,83 @@
+// Command migrate applies the SQL schema migrations of the sql storage backend.
+//
+//	go run -tags sqlite ./cmd/migrate -driver sqlite3 -dsn graphql.db up
+//	go run -tags postgres ./cmd/migrate -driver postgres -dsn "postgres://localhost/graphql?sslmode=disable" status
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore"
+	_ "github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore/drivers" // drivers selected with build tags
+	"github.com/pkg/errors"
+)
+
+func main() {
+	driver := flag.String("driver", os.Getenv("SQL_DRIVER"), "database/sql driver: postgres or sqlite3")
+	dsn := flag.String("dsn", os.Getenv("SQL_DSN"), "data source name of the database")
+	dir := flag.String("dir", "store/sqlstore/migrations", "directory holding a migrations folder per dialect")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: migrate [flags] [up|status]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "up"
+	}
+	if err := run(context.Background(), command, *driver, *dsn, *dir); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run executes a migrate command against the database
+func run(ctx context.Context, command, driver, dsn, dir string) error {
+	dialect, err := sqlstore.DialectForDriver(driver)
+	if err != nil {
+		return err
+	}
+	migrations, err := sqlstore.LoadMigrations(sqlstore.MigrationsDir(dir, dialect))
+	if err != nil {
+		return errors.Wrap(err, "Failed to load migrations")
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open the %s database, is the driver built in?", driver)
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		applied, err := sqlstore.Migrate(ctx, db, dialect, migrations)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "status":
+		applied, err := sqlstore.AppliedVersions(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := "pending"
+			if applied[migration.Version] {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %04d_%s\n", state, migration.Version, migration.Name)
+		}
+	default:
+		return errors.Errorf("Unknown command %q, use up or status", command)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Command reindex asks the GraphQL server to index every stored post for searchPosts,
+// which backfills the posts written before search existed or while the index was failing.
+// The server runs the reindexPosts task in the background and logs when it is done.
+//
+//	AUTH_TOKEN=$(AUTH_SECRET=... go run ./cmd/token -admin) go run ./cmd/reindex -server https://graphqlserver-259904.appspot.com
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/resolvers"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "base URL of the GraphQL server")
+	token := flag.String("token", os.Getenv("AUTH_TOKEN"), "admin bearer token, issued with cmd/token")
+	start := flag.String("start", "", "store cursor to resume from, the argument of a failed reindexPosts task in the server logs")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: reindex [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *token == "" {
+		log.Fatal("-token or AUTH_TOKEN is required")
+	}
+	if err := reindex(*server, *token, *start); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// reindex enqueues the reindexPosts task on the server, from the cursor start
+func reindex(server, token, start string) error {
+	form := url.Values{"arg": {start}}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(server, "/")+"/admin/tasks/"+resolvers.ReindexPostsTask, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to start reindexing")
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Failed to start reindexing: %s %s", resp.Status, body)
+	}
+	fmt.Printf("enqueued %s, the server logs when every post is indexed\n", resolvers.ReindexPostsTask)
+	return nil
+}
@@ -0,0 +1,40 @@
+// Command token issues bearer tokens for the GraphQL server, signed with the
+// AUTH_SECRET the server runs with.
+//
+//	AUTH_SECRET=... go run ./cmd/token -user VXNlcjo1NzY4MDM3OTk5MzEyODk2
+//	AUTH_SECRET=... go run ./cmd/token -admin -ttl 1h
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/resolvers"
+)
+
+func main() {
+	userID := flag.String("user", "", "global or numeric id of the user the token acts as")
+	admin := flag.Bool("admin", false, "whether the token may change content of any user")
+	ttl := flag.Duration("ttl", 24*time.Hour, "lifetime of the token")
+	flag.Parse()
+
+	secret := os.Getenv("AUTH_SECRET")
+	if secret == "" {
+		log.Fatal("AUTH_SECRET must be set")
+	}
+	if *userID == "" && !*admin {
+		log.Fatal("-user or -admin is required")
+	}
+	if nodeType, id, ok := resolvers.ParseGlobalID(*userID); ok { // tokens carry the store id
+		if nodeType != resolvers.UserNode {
+			log.Fatalf("%s is the id of a %s", *userID, nodeType)
+		}
+		*userID = id
+	}
+	signer := auth.NewSigner([]byte(secret))
+	fmt.Println(signer.Sign(auth.Viewer{UserID: *userID, Admin: *admin}, time.Now().Add(*ttl)))
+}
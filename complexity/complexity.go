@@ -0,0 +1,246 @@
+package complexity
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// maxValue caps costs and multipliers, so that nesting large lists cannot overflow
+const maxValue = math.MaxInt32
+
+// Field describes the cost of a field
+type Field struct {
+	Cost              int      // cost of resolving the field once, or of every node a list fetches
+	Multipliers       []string // Int or list arguments giving how many times the selections of the field resolve, e.g. first
+	DefaultMultiplier int      // multiplier when none of the arguments is given, 1 when 0
+	Offsets           []string // Int arguments counting the nodes a list fetches and skips, e.g. offset
+	Fanouts           []string // list arguments running the whole field once per item, e.g. the ids of the authors of posts
+}
+
+// Costs holds the costs of fields by "Type.field", other fields cost nothing
+type Costs map[string]Field
+
+// Measure is the depth and the cost of an operation
+type Measure struct {
+	Depth int `json:"depth"` // number of nested fields, introspection fields aside
+	Cost  int `json:"cost"`
+}
+
+// measurer walks the selections of an operation
+type measurer struct {
+	schema    *graphql.Schema
+	costs     Costs
+	fragments map[string]*ast.FragmentDefinition
+	measured  map[string]Measure // fragments by name, each is measured once however often it is spread
+	variables map[string]interface{}
+	defaults  map[string]ast.Value // default values of the variables of the operation
+}
+
+// Of measures operation, one of the definitions of document, which must have passed validation.
+// The cost of a field is its own plus the cost of its selections times its multiplier, times its fanout.
+// A field with multipliers is a list, whose own cost is paid for every node it fetches, skipped ones included.
+func Of(schema *graphql.Schema, document *ast.Document, operation *ast.OperationDefinition, variables map[string]interface{}, costs Costs) Measure {
+	m := &measurer{
+		schema:    schema,
+		costs:     costs,
+		fragments: map[string]*ast.FragmentDefinition{},
+		measured:  map[string]Measure{},
+		variables: variables,
+		defaults:  map[string]ast.Value{},
+	}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			m.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range operation.VariableDefinitions {
+		if definition.DefaultValue != nil {
+			m.defaults[definition.Variable.Name.Value] = definition.DefaultValue
+		}
+	}
+
+	var root *graphql.Object
+	switch operation.Operation {
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	default:
+		root = schema.QueryType()
+	}
+	return m.selectionSet(root, operation.SelectionSet)
+}
+
+// selectionSet measures the selections of a field of type parent
+func (m *measurer) selectionSet(parent graphql.Type, set *ast.SelectionSet) Measure {
+	total := Measure{}
+	if set == nil {
+		return total
+	}
+	for _, selection := range set.Selections {
+		var measure Measure
+		switch selection := selection.(type) {
+		case *ast.Field:
+			measure = m.field(parent, selection)
+		case *ast.InlineFragment:
+			typ := parent
+			if selection.TypeCondition != nil {
+				typ = m.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			measure = m.selectionSet(typ, selection.SelectionSet)
+		case *ast.FragmentSpread:
+			measure = m.fragment(selection.Name.Value)
+		}
+		total.Cost = add(total.Cost, measure.Cost)
+		if measure.Depth > total.Depth {
+			total.Depth = measure.Depth
+		}
+	}
+	return total
+}
+
+// fragment measures the fragment with the given name
+func (m *measurer) fragment(name string) Measure {
+	if measure, ok := m.measured[name]; ok {
+		return measure
+	}
+	fragment, ok := m.fragments[name]
+	if !ok {
+		return Measure{}
+	}
+	measure := m.selectionSet(m.schema.Type(fragment.TypeCondition.Name.Value), fragment.SelectionSet)
+	m.measured[name] = measure
+	return measure
+}
+
+// field measures a field selected on type parent
+func (m *measurer) field(parent graphql.Type, field *ast.Field) Measure {
+	name := field.Name.Value
+	if strings.HasPrefix(name, "__") { // introspection is bounded by the schema
+		return Measure{}
+	}
+	var fields graphql.FieldDefinitionMap
+	switch parent := parent.(type) {
+	case *graphql.Object:
+		fields = parent.Fields()
+	case *graphql.Interface:
+		fields = parent.Fields()
+	}
+	definition, ok := fields[name]
+	if !ok {
+		return Measure{Depth: 1}
+	}
+	named, _ := graphql.GetNamed(definition.Type).(graphql.Type)
+	selections := m.selectionSet(named, field.SelectionSet)
+	cost := m.costs[parent.Name()+"."+name]
+	multiplier := m.multiplier(cost, field)
+	own := cost.Cost
+	if len(cost.Multipliers) > 0 { // a list pays for every node it fetches, and for one query at least
+		offset, _ := m.argument(cost.Offsets, field)
+		if fetched := add(multiplier, offset); fetched > 1 {
+			own = multiply(own, fetched)
+		}
+	}
+	fanout, ok := m.argument(cost.Fanouts, field)
+	if !ok {
+		fanout = 1
+	}
+	return Measure{
+		Depth: selections.Depth + 1,
+		Cost:  multiply(fanout, add(own, multiply(multiplier, selections.Cost))),
+	}
+}
+
+// multiplier returns how many times the selections of field resolve
+func (m *measurer) multiplier(cost Field, field *ast.Field) int {
+	if n, ok := m.argument(cost.Multipliers, field); ok {
+		return n
+	}
+	if cost.DefaultMultiplier > 0 {
+		return cost.DefaultMultiplier
+	}
+	return 1
+}
+
+// argument returns the size of the first of the arguments names given to field, ok is false when none is
+func (m *measurer) argument(names []string, field *ast.Field) (n int, ok bool) {
+	for _, name := range names {
+		for _, argument := range field.Arguments {
+			if argument.Name.Value != name {
+				continue
+			}
+			if n, ok := m.size(argument.Value); ok {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// size returns the number an Int argument holds, or the length of a list argument
+func (m *measurer) size(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.ParseFloat(value.Value, 64)
+		return clamp(n), err == nil
+	case *ast.ListValue:
+		return len(value.Values), true
+	case *ast.Variable:
+		name := value.Name.Value
+		if variable, ok := m.variables[name]; ok {
+			return sizeOf(variable)
+		}
+		if defaultValue, ok := m.defaults[name]; ok {
+			return m.size(defaultValue)
+		}
+	}
+	return 0, false // null, or a variable left out, which the field treats as missing
+}
+
+// sizeOf returns the number a variable holds, or the length of a list variable
+func sizeOf(variable interface{}) (int, bool) {
+	switch variable := variable.(type) {
+	case int:
+		return clamp(float64(variable)), true
+	case float64:
+		return clamp(variable), true
+	case json.Number:
+		n, err := variable.Float64()
+		return clamp(n), err == nil
+	case []interface{}:
+		return len(variable), true
+	}
+	return 0, false
+}
+
+// clamp converts n to an int between 0 and maxValue
+func clamp(n float64) int {
+	switch {
+	case n < 0:
+		return 0
+	case n > maxValue:
+		return maxValue
+	}
+	return int(n)
+}
+
+// add returns a+b, at most maxValue
+func add(a, b int) int {
+	if a > maxValue-b {
+		return maxValue
+	}
+	return a + b
+}
+
+// multiply returns a*b, at most maxValue
+func multiply(a, b int) int {
+	if b != 0 && a > maxValue/b {
+		return maxValue
+	}
+	return a * b
+}
@@ -0,0 +1,113 @@
+package consistency
+
+import (
+	"context"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+)
+
+// Report summarizes a scan of the posts
+type Report struct {
+	Checked  int // posts scanned
+	Orphans  int // posts whose author does not exist
+	Repaired int // orphaned posts deleted
+}
+
+// CheckPosts scans every post in batches and calls found for each post whose
+// author does not exist. When repair is set it deletes those posts, and removes
+// them from the index x unless x is nil, when the index cannot be reached.
+func CheckPosts(ctx context.Context, s store.Store, x search.Index, repair bool, found func(post m.Post)) (Report, error) {
+	var report Report
+	query := store.PostQuery{Limit: store.MaxBatchSize}
+	for {
+		page, err := s.ListPosts(ctx, query)
+		if err != nil {
+			return report, err
+		}
+		report.Checked += len(page.Posts)
+
+		exists, err := usersExist(ctx, s, page.Posts)
+		if err != nil {
+			return report, err
+		}
+		var orphans []string
+		for _, post := range page.Posts {
+			if !exists[post.UserID] {
+				found(post)
+				orphans = append(orphans, post.ID)
+			}
+		}
+		report.Orphans += len(orphans)
+		if repair && len(orphans) > 0 {
+			if err := s.DeletePosts(ctx, orphans); err != nil {
+				return report, err
+			}
+			report.Repaired += len(orphans)
+			if err := unindex(ctx, x, orphans); err != nil {
+				return report, err
+			}
+		}
+
+		if !page.More {
+			return report, nil
+		}
+		query.Start = page.End
+	}
+}
+
+// unindex removes the posts ids from the index x, in batches it accepts
+func unindex(ctx context.Context, x search.Index, ids []string) error {
+	if x == nil {
+		return nil
+	}
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > search.MaxBatchSize {
+			n = search.MaxBatchSize
+		}
+		if err := x.DeletePosts(ctx, ids[:n]); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// usersExist reports which authors of posts exist
+func usersExist(ctx context.Context, s store.Store, posts []m.Post) (map[string]bool, error) {
+	var ids []string
+	exists := map[string]bool{}
+	for _, post := range posts {
+		if _, ok := exists[post.UserID]; !ok {
+			exists[post.UserID] = false
+			ids = append(ids, post.UserID)
+		}
+	}
+	if len(ids) == 0 {
+		return exists, nil
+	}
+
+	users, err := s.GetUsers(ctx, ids)
+	if err == store.ErrInvalidID { // a malformed UserID spoils the batch, look the users up one by one
+		for _, id := range ids {
+			_, err := s.GetUser(ctx, id)
+			switch err {
+			case nil:
+				exists[id] = true
+			case store.ErrNotFound, store.ErrInvalidID:
+			default:
+				return nil, err
+			}
+		}
+		return exists, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, user := range users {
+		exists[ids[i]] = user != nil
+	}
+	return exists, nil
+}
@@ -0,0 +1,46 @@
+package consistency
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/memsearch"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/memstore"
+)
+
+func TestCheckPosts(t *testing.T) {
+	ctx := context.Background()
+	s, x := memstore.New(), memsearch.New()
+	author := &m.User{Name: "Ann"}
+	if err := s.PutUser(ctx, author); err != nil {
+		t.Fatal(err)
+	}
+	posts := []m.Post{{UserID: author.ID, Content: "hello kept"}, {UserID: "999", Content: "hello orphan"}}
+	for i := range posts {
+		if err := s.PutPost(ctx, &posts[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := x.PutPosts(ctx, posts); err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	report, err := CheckPosts(ctx, s, x, true, func(post m.Post) { found = append(found, post.ID) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Report{Checked: 2, Orphans: 1, Repaired: 1}); report != want || !reflect.DeepEqual(found, []string{posts[1].ID}) {
+		t.Errorf("CheckPosts = %+v reporting %v, want %+v reporting %v", report, found, want, []string{posts[1].ID})
+	}
+	if _, err := s.GetPost(ctx, posts[1].ID); err == nil {
+		t.Errorf("orphaned post %s is still stored", posts[1].ID)
+	}
+	page, err := x.SearchPosts(ctx, search.Query{Text: "hello", Limit: 10})
+	if err != nil || !reflect.DeepEqual(page.PostIDs, []string{posts[0].ID}) {
+		t.Errorf("SearchPosts after the repair = %v, %v, want only %s", page.PostIDs, err, posts[0].ID)
+	}
+}
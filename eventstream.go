@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/middleware"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+var heartbeatInterval = 15 * time.Second // declare the time between the comments keeping an idle event stream open through proxies
+
+// eventStream writes Server-Sent Events, with the `next` and `complete` events of the graphql-sse protocol
+type eventStream struct {
+	mu      sync.Mutex // serializes the events and heartbeats
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// acceptsEventStream reports whether the client asked for the result as Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// serveEventStream executes request and streams its results as Server-Sent Events, a query or
+// mutation once and a subscription for every event of its field until the client disconnects.
+// An EventSource reconnecting with `Last-Event-ID` resumes after the last event it received.
+func serveEventStream(ctx context.Context, w http.ResponseWriter, r *http.Request, request middleware.GraphQLRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		middleware.ResponseError(w, "Streaming is not supported by this server", http.StatusNotAcceptable)
+		return
+	}
+	params := graphql.Params{
+		Schema:         schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        ctx,
+	}
+	operation, measure, result := parseOperation(request)
+	if result != nil {
+		middleware.ResponseGraphQL(w, result)
+		return
+	}
+	var field *ast.Field
+	if operation.Operation == ast.OperationTypeSubscription {
+		if field, result = subscriptionField(operation); result == nil {
+			result = checkSubscription(params)
+		}
+		if result != nil { // reported before the stream opens, so that the client does not reconnect
+			middleware.ResponseGraphQL(w, result)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the events
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush() // clients learn the stream is open before the first event or heartbeat
+	stream := &eventStream{w: w, flusher: flusher}
+	if field == nil {
+		result := doGraphQL(params)
+		result.Extensions = complexityExtensions(measure)
+		middleware.FormatResult(result)
+		stream.send("next", "", result)
+		stream.send("complete", "", nil)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx) // ends with the request, when the client disconnects
+	heartbeats := make(chan struct{})
+	go func() {
+		defer close(heartbeats)
+		stream.heartbeat(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-heartbeats // nothing may be written once the handler returns
+	}()
+	result = streamSubscription(ctx, params, field, r.Header.Get("Last-Event-ID"), func(event pubsub.Event, result *graphql.Result) {
+		stream.send("next", event.ID, result)
+	})
+	if result != nil {
+		middleware.FormatResult(result)
+		stream.send("next", "", result)
+		stream.send("complete", "", nil)
+	}
+}
+
+// send writes an event, data is encoded as JSON
+func (s *eventStream) send(event, id string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "event: %s\n", event)
+	if id != "" {
+		fmt.Fprintf(s.w, "id: %s\n", id)
+	}
+	payload := []byte{}
+	if data != nil {
+		payload, _ = json.Marshal(data)
+	}
+	fmt.Fprintf(s.w, "data: %s\n\n", payload)
+	s.flusher.Flush()
+}
+
+// heartbeat writes a comment every heartbeatInterval until ctx is done
+func (s *eventStream) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			fmt.Fprint(s.w, ": heartbeat\n\n")
+			s.flusher.Flush()
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+)
+
+// sseEvent is a block of an event stream, an event or a comment
+type sseEvent struct {
+	event, id, data, comment string
+}
+
+// openEventStream runs query from an EventSource resuming after lastEventID, it fails unless
+// the response headers arrive within a second
+func openEventStream(t *testing.T, server *httptest.Server, query, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	r, err := http.NewRequest(http.MethodGet, server.URL+"/graphql?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		responses <- resp
+	}()
+	select {
+	case resp, ok := <-responses:
+		if !ok {
+			t.FailNow()
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("response = %d %s, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body)
+	case <-time.After(time.Second):
+		t.Fatal("no response headers before the first event")
+		return nil
+	}
+}
+
+// readEvent reads the next block of a stream
+func readEvent(t *testing.T, stream *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return event
+		}
+		switch {
+		case strings.HasPrefix(line, ":"):
+			event.comment = strings.TrimSpace(line[1:])
+		case strings.HasPrefix(line, "event: "):
+			event.event = line[len("event: "):]
+		case strings.HasPrefix(line, "id: "):
+			event.id = line[len("id: "):]
+		case strings.HasPrefix(line, "data: "):
+			event.data = line[len("data: "):]
+		}
+	}
+}
+
+// publishPosts publishes a postCreated event for each of contents, and returns their IDs
+func publishPosts(t *testing.T, contents ...string) []string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := dataBackend.broker.Subscribe(ctx, pubsub.PostCreated, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, content := range contents {
+		if err := dataBackend.broker.Publish(ctx, pubsub.Event{Topic: pubsub.PostCreated, Post: m.Post{Content: content}}); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, (<-events).ID)
+	}
+	return ids
+}
+
+func TestEventStream(t *testing.T) {
+	server := newTestServer(t)
+	seedUser(t, "Ann")
+
+	t.Run("query", func(t *testing.T) {
+		stream := openEventStream(t, server, `{ users(first: 1) { nodes { name } } }`, "")
+		if event := readEvent(t, stream); event.event != "next" || !strings.Contains(event.data, `"name":"Ann"`) {
+			t.Errorf("first event = %+v, want the users", event)
+		}
+		if event := readEvent(t, stream); event.event != "complete" {
+			t.Errorf("second event = %+v, want complete", event)
+		}
+	})
+
+	t.Run("idle subscription", func(t *testing.T) {
+		openEventStream(t, server, `subscription { postUpdated { content } }`, "") // no event, and no heartbeat for 15s
+	})
+
+	t.Run("subscription resuming after Last-Event-ID", func(t *testing.T) {
+		ids := publishPosts(t, "seen", "missed")
+		stream := openEventStream(t, server, `subscription { postCreated { content } }`, ids[0])
+		if event := readEvent(t, stream); event.event != "next" || event.id != ids[1] || !strings.Contains(event.data, `"content":"missed"`) {
+			t.Errorf("replayed event = %+v, want the missed post with id %s", event, ids[1])
+		}
+		ids = publishPosts(t, "live") // the replay came from the subscription, which is registered by now
+		if event := readEvent(t, stream); event.event != "next" || event.id != ids[0] || !strings.Contains(event.data, `"content":"live"`) {
+			t.Errorf("live event = %+v, want the new post with id %s", event, ids[0])
+		}
+	})
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	interval := heartbeatInterval
+	t.Cleanup(func() { heartbeatInterval = interval }) // once the server has closed, and its handlers have returned
+	heartbeatInterval = 10 * time.Millisecond
+	server := newTestServer(t)
+	stream := openEventStream(t, server, `subscription { postDeleted { content } }`, "")
+	if event := readEvent(t, stream); event.comment != "heartbeat" {
+		t.Errorf("event of an idle stream = %+v, want a heartbeat", event)
+	}
+}
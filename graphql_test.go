@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/resolvers"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+)
+
+// testTime is the creation time of the first seeded entity, the others follow a minute apart
+var testTime = time.Date(2019, 12, 1, 10, 0, 0, 0, time.UTC)
+
+// gqlError is an entry of the `errors` of a response
+type gqlError struct {
+	Message    string                 `json:"message"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// gqlResponse is the body of a response to a single operation
+type gqlResponse struct {
+	Data       json.RawMessage        `json:"data"`
+	Errors     []gqlError             `json:"errors"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// code returns the code of the first error, empty when there is none
+func (r gqlResponse) code() string {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+// decode unmarshals the data of the response into v
+func (r gqlResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("decoding %s: %v", r.Data, err)
+	}
+}
+
+// newTestServer serves the app over a fresh in-memory backend, with tokens signed by tokenSigner
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	b, err := newMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataBackend = b
+	tokenSigner = auth.NewSigner([]byte("test secret"))
+	server := httptest.NewServer(muxRouter)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// tokenFor returns a bearer token identifying viewer, empty for anonymous requests
+func tokenFor(viewer auth.Viewer) string {
+	if !viewer.Authenticated() {
+		return ""
+	}
+	return tokenSigner.Sign(viewer, time.Now().Add(time.Hour))
+}
+
+// postJSON posts body to /graphql as JSON, and returns the status and body of the response
+func postJSON(t *testing.T, server *httptest.Server, token string, body interface{}) (int, []byte) {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.NewRequest(http.MethodPost, server.URL+"/graphql", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// runQuery runs an operation on behalf of viewer
+func runQuery(t *testing.T, server *httptest.Server, viewer auth.Viewer, query string, variables map[string]interface{}) gqlResponse {
+	t.Helper()
+	_, data := postJSON(t, server, tokenFor(viewer), map[string]interface{}{"query": query, "variables": variables})
+	var resp gqlResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return resp
+}
+
+// seedUser stores a user along with posts holding contents, created a minute apart
+func seedUser(t *testing.T, name string, contents ...string) m.User {
+	t.Helper()
+	ctx := context.Background()
+	user := &m.User{Name: name, CreatedAt: testTime}
+	if err := dataBackend.store.PutUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range contents {
+		at := testTime.Add(time.Duration(i) * time.Minute)
+		post := &m.Post{UserID: user.ID, Content: content, CreatedAt: at, UpdatedAt: at}
+		if err := dataBackend.store.PutPost(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return *user
+}
+
+// postList is the part of a posts connection the tests look at
+type postList struct {
+	Nodes []struct {
+		Content string `json:"content"`
+	} `json:"nodes"`
+	PageInfo struct {
+		HasNextPage     bool   `json:"hasNextPage"`
+		HasPreviousPage bool   `json:"hasPreviousPage"`
+		EndCursor       string `json:"endCursor"`
+	} `json:"pageInfo"`
+	TotalCount int `json:"totalCount"`
+}
+
+// contents returns the content of the posts of the list
+func (list postList) contents() []string {
+	contents := []string{}
+	for _, node := range list.Nodes {
+		contents = append(contents, node.Content)
+	}
+	return contents
+}
+
+func TestPagination(t *testing.T) {
+	server := newTestServer(t)
+	seedUser(t, "Ann", "p1", "p2", "p3", "p4", "p5")
+
+	tests := []struct {
+		name     string
+		args     string
+		want     []string
+		wantNext bool
+	}{
+		{"newest first by default", "first: 2", []string{"p5", "p4"}, true},
+		{"last", "last: 2", []string{"p2", "p1"}, false},
+		{"oldest first", "first: 2, orderBy: {field: CREATED_AT, direction: ASC}", []string{"p1", "p2"}, true},
+		{"limit and offset", "limit: 2, offset: 3", []string{"p2", "p1"}, false},
+		{"whole list", "first: 10", []string{"p5", "p4", "p3", "p2", "p1"}, false},
+		{"created after", `first: 10, createdAfter: "2019-12-01T10:02:00Z"`, []string{"p5", "p4"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := runQuery(t, server, auth.Viewer{}, `{ posts(`+test.args+`) { nodes { content } pageInfo { hasNextPage } totalCount } }`, nil)
+			if len(resp.Errors) > 0 {
+				t.Fatalf("errors: %+v", resp.Errors)
+			}
+			var data struct{ Posts postList }
+			resp.decode(t, &data)
+			if got := data.Posts.contents(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("posts = %v, want %v", got, test.want)
+			}
+			if data.Posts.PageInfo.HasNextPage != test.wantNext {
+				t.Errorf("hasNextPage = %v, want %v", data.Posts.PageInfo.HasNextPage, test.wantNext)
+			}
+			if data.Posts.TotalCount != 5 && !strings.Contains(test.args, "createdAfter") {
+				t.Errorf("totalCount = %d, want 5", data.Posts.TotalCount)
+			}
+		})
+	}
+
+	t.Run("cursors walk the whole list", func(t *testing.T) {
+		var got []string
+		after := ""
+		for pages := 0; pages < 5; pages++ {
+			resp := runQuery(t, server, auth.Viewer{}, `query($after: String) { posts(first: 2, after: $after) { nodes { content } pageInfo { hasNextPage endCursor } } }`,
+				map[string]interface{}{"after": after})
+			if len(resp.Errors) > 0 {
+				t.Fatalf("errors: %+v", resp.Errors)
+			}
+			var data struct{ Posts postList }
+			resp.decode(t, &data)
+			got = append(got, data.Posts.contents()...)
+			if !data.Posts.PageInfo.HasNextPage {
+				break
+			}
+			after = data.Posts.PageInfo.EndCursor
+		}
+		if want := []string{"p5", "p4", "p3", "p2", "p1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("posts = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("malformed cursor", func(t *testing.T) {
+		resp := runQuery(t, server, auth.Viewer{}, `{ posts(first: 2, after: "nonsense") { nodes { content } } }`, nil)
+		if resp.code() != "INVALID_ARGUMENT" {
+			t.Errorf("code = %q, want INVALID_ARGUMENT (errors %+v)", resp.code(), resp.Errors)
+		}
+	})
+}
+
+func TestPaginationOfTiedPosts(t *testing.T) {
+	server := newTestServer(t)
+	ann, bob := seedUser(t, "Ann"), seedUser(t, "Bob")
+	for _, post := range []m.Post{{UserID: ann.ID, Content: "a1"}, {UserID: bob.ID, Content: "b1"}, {UserID: ann.ID, Content: "a2"}, {UserID: bob.ID, Content: "b2"}} {
+		post.CreatedAt, post.UpdatedAt = testTime, testTime // every post at the same time, in the order of their IDs
+		if err := dataBackend.store.PutPost(context.Background(), &post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := []string{resolvers.GlobalID(resolvers.UserNode, ann.ID), resolvers.GlobalID(resolvers.UserNode, bob.ID)}
+	const query = `query($ids: [UserID!], $after: String, $before: String) {
+		posts(userIDs: $ids, first: 10, after: $after, before: $before) { edges { cursor node { content } } }
+	}`
+	list := func(t *testing.T, variables map[string]interface{}) (contents, cursors []string) {
+		t.Helper()
+		resp := runQuery(t, server, auth.Viewer{}, query, variables)
+		if len(resp.Errors) > 0 {
+			t.Fatalf("errors: %+v", resp.Errors)
+		}
+		var data struct {
+			Posts struct {
+				Edges []struct {
+					Cursor string
+					Node   struct{ Content string }
+				}
+			}
+		}
+		resp.decode(t, &data)
+		for _, edge := range data.Posts.Edges {
+			contents, cursors = append(contents, edge.Node.Content), append(cursors, edge.Cursor)
+		}
+		return contents, cursors
+	}
+
+	for _, authors := range []struct {
+		name string
+		ids  interface{}
+	}{{"every author", nil}, {"several authors", ids}} {
+		t.Run(authors.name, func(t *testing.T) {
+			all, cursors := list(t, map[string]interface{}{"ids": authors.ids})
+			if want := []string{"b2", "a2", "b1", "a1"}; !reflect.DeepEqual(all, want) {
+				t.Fatalf("posts = %v, want %v", all, want)
+			}
+			for _, test := range []struct {
+				name          string
+				after, before int // index of the cursor, -1 for none
+				want          []string
+			}{
+				{"after", 0, -1, all[1:]},
+				{"before", -1, 3, all[:3]},
+				{"after and before", 0, 3, all[1:3]},
+			} {
+				variables := map[string]interface{}{"ids": authors.ids}
+				if test.after >= 0 {
+					variables["after"] = cursors[test.after]
+				}
+				if test.before >= 0 {
+					variables["before"] = cursors[test.before]
+				}
+				if got, _ := list(t, variables); !reflect.DeepEqual(got, test.want) {
+					t.Errorf("%s: posts = %v, want %v", test.name, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPostsOfUsers(t *testing.T) {
+	server := newTestServer(t)
+	ann := seedUser(t, "Ann", "a1", "a2")
+	seedUser(t, "Bob", "b1")
+	annID := resolvers.GlobalID(resolvers.UserNode, ann.ID)
+
+	tests := []struct {
+		name  string
+		query string
+		want  map[string][]string // contents of the posts of each user, by name
+	}{
+		{"users", `{ users(first: 10) { nodes { name posts(first: 10) { nodes { content } } } } }`,
+			map[string][]string{"Ann": {"a2", "a1"}, "Bob": {"b1"}}},
+		{"user", `{ user(id: "` + annID + `") { name posts(first: 10) { nodes { content } } } }`,
+			map[string][]string{"Ann": {"a2", "a1"}}},
+		{"node", `{ node(id: "` + annID + `") { ... on User { name posts(first: 10) { nodes { content } } } } }`,
+			map[string][]string{"Ann": {"a2", "a1"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := runQuery(t, server, auth.Viewer{}, test.query, nil)
+			if len(resp.Errors) > 0 {
+				t.Fatalf("errors: %+v", resp.Errors)
+			}
+			type userPosts struct {
+				Name  string
+				Posts postList
+			}
+			var data struct {
+				Users struct{ Nodes []userPosts }
+				User  *userPosts
+				Node  *userPosts
+			}
+			resp.decode(t, &data)
+			users := data.Users.Nodes
+			for _, user := range []*userPosts{data.User, data.Node} {
+				if user != nil {
+					users = append(users, *user)
+				}
+			}
+			got := map[string][]string{}
+			for _, user := range users {
+				got[user.Name] = user.Posts.contents()
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("posts by user = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthorsOfLegacyPosts(t *testing.T) {
+	server := newTestServer(t)
+	seedUser(t, "Ann", "hello")
+	legacy := &m.Post{UserID: "legacy-name", Content: "legacy", CreatedAt: testTime.Add(time.Hour), UpdatedAt: testTime.Add(time.Hour)}
+	if err := dataBackend.store.PutPost(context.Background(), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := runQuery(t, server, auth.Viewer{}, `{ posts(first: 10) { nodes { content author { name } } } }`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors: %+v", resp.Errors)
+	}
+	var data struct {
+		Posts struct {
+			Nodes []struct {
+				Content string
+				Author  *struct{ Name string }
+			}
+		}
+	}
+	resp.decode(t, &data)
+	authors := map[string]string{}
+	for _, node := range data.Posts.Nodes {
+		if node.Author != nil {
+			authors[node.Content] = node.Author.Name
+		}
+	}
+	if want := map[string]string{"hello": "Ann"}; !reflect.DeepEqual(authors, want) {
+		t.Errorf("authors = %v, want %v", authors, want)
+	}
+}
+
+func TestMutationsOverGET(t *testing.T) {
+	server := newTestServer(t)
+	ann := seedUser(t, "Ann")
+	annID := resolvers.GlobalID(resolvers.UserNode, ann.ID)
+
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		wantStatus    int
+	}{
+		{"query", `{ user(id: "` + annID + `") { name } }`, "", http.StatusOK},
+		{"mutation", `mutation { updateUser(input: {id: "` + annID + `", name: "Bob"}) { user { name } } }`, "", http.StatusMethodNotAllowed},
+		{"mutation among queries", `query q { user(id: "` + annID + `") { name } } mutation m { deleteUser(input: {id: "` + annID + `"}) { user { id } } }`, "m", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := server.URL + "/graphql?" + url.Values{"query": {test.query}, "operationName": {test.operationName}}.Encode()
+			req, _ := http.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set("Authorization", "Bearer "+tokenFor(auth.Viewer{Admin: true}))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+			if test.wantStatus == http.StatusMethodNotAllowed && resp.Header.Get("Allow") != http.MethodPost {
+				t.Errorf("Allow = %q, want POST", resp.Header.Get("Allow"))
+			}
+		})
+	}
+	if user, err := dataBackend.store.GetUser(context.Background(), ann.ID); err != nil || user.Name != "Ann" {
+		t.Errorf("user = %+v, %v, want Ann unchanged", user, err)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	server := newTestServer(t)
+	other := seedUser(t, "Eve")
+	const (
+		createPost = `mutation($user: UserID!) { createPost(input: {userID: $user, content: "New"}) { post { content } } }`
+		updatePost = `mutation($post: PostID!) { updatePost(input: {id: $post, content: "Edited"}) { post { content } } }`
+		deletePost = `mutation($post: PostID!) { deletePost(input: {id: $post}) { post { content } } }`
+		updateUser = `mutation($user: UserID!) { updateUser(input: {id: $user, name: "Renamed"}) { user { name } } }`
+		deleteUser = `mutation($user: UserID!) { deleteUser(input: {id: $user}) { user { name } } }`
+	)
+	anonymous, admin, another := auth.Viewer{}, auth.Viewer{Admin: true}, auth.Viewer{UserID: other.ID}
+	self := auth.Viewer{UserID: "self"} // stands for the user seeded by the test
+
+	tests := []struct {
+		name     string
+		mutation string
+		viewer   auth.Viewer
+		wantCode string
+	}{
+		{"createPost anonymous", createPost, anonymous, "UNAUTHENTICATED"},
+		{"createPost as another user", createPost, another, "FORBIDDEN"},
+		{"createPost as self", createPost, self, ""},
+		{"createPost as admin", createPost, admin, ""},
+		{"updatePost anonymous", updatePost, anonymous, "UNAUTHENTICATED"},
+		{"updatePost of another user", updatePost, another, "FORBIDDEN"},
+		{"updatePost of self", updatePost, self, ""},
+		{"updatePost as admin", updatePost, admin, ""},
+		{"deletePost of another user", deletePost, another, "FORBIDDEN"},
+		{"deletePost of self", deletePost, self, ""},
+		{"updateUser anonymous", updateUser, anonymous, "UNAUTHENTICATED"},
+		{"updateUser of another user", updateUser, another, "FORBIDDEN"},
+		{"updateUser of self", updateUser, self, ""},
+		{"updateUser as admin", updateUser, admin, ""},
+		{"deleteUser anonymous", deleteUser, anonymous, "UNAUTHENTICATED"},
+		{"deleteUser of another user", deleteUser, another, "FORBIDDEN"},
+		{"deleteUser of self", deleteUser, self, ""},
+		{"deleteUser as admin", deleteUser, admin, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := seedUser(t, "Ann", "Hi!")
+			page, err := dataBackend.store.ListPosts(context.Background(), store.PostQuery{UserID: user.ID, Limit: -1})
+			if err != nil || len(page.Posts) != 1 {
+				t.Fatalf("seeded posts: %v, %v", page.Posts, err)
+			}
+			viewer := test.viewer
+			if viewer == self {
+				viewer.UserID = user.ID
+			}
+			resp := runQuery(t, server, viewer, test.mutation, map[string]interface{}{
+				"user": resolvers.GlobalID(resolvers.UserNode, user.ID),
+				"post": resolvers.GlobalID(resolvers.PostNode, page.Posts[0].ID),
+			})
+			if resp.code() != test.wantCode {
+				t.Fatalf("code = %q, want %q (errors %+v)", resp.code(), test.wantCode, resp.Errors)
+			}
+			if test.wantCode == "" {
+				return
+			}
+			// nothing changed
+			if got, err := dataBackend.store.GetUser(context.Background(), user.ID); err != nil || got.Name != "Ann" {
+				t.Errorf("user after a refused mutation = %+v, %v, want Ann", got, err)
+			}
+			if got, err := dataBackend.store.CountPosts(context.Background(), store.PostQuery{UserID: user.ID}); err != nil || got != 1 {
+				t.Errorf("posts after a refused mutation = %d, %v, want 1", got, err)
+			}
+			if got, err := dataBackend.store.GetPost(context.Background(), page.Posts[0].ID); err != nil || got.Content != "Hi!" {
+				t.Errorf("post after a refused mutation = %+v, %v, want Hi!", got, err)
+			}
+		})
+	}
+
+	t.Run("invalid token", func(t *testing.T) {
+		status, _ := postJSON(t, server, "forged", map[string]interface{}{"query": "{ users { nodes { name } } }"})
+		if status != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestValidationUserErrors(t *testing.T) {
+	server := newTestServer(t)
+	user := seedUser(t, "Ann")
+	userID := resolvers.GlobalID(resolvers.UserNode, user.ID)
+	viewer := auth.Viewer{UserID: user.ID}
+
+	tests := []struct {
+		name      string
+		viewer    auth.Viewer
+		mutation  string
+		variables map[string]interface{}
+		wantField []string
+		wantIn    string // part of the message
+	}{
+		{"blank name", viewer, `createUser(input: {name: "   "}) { userErrors { field message } }`, nil, []string{"input", "name"}, "blank"},
+		{"zero width name", viewer, `createUser(input: {name: "\u200b \u200d"}) { userErrors { field message } }`, nil, []string{"input", "name"}, "blank"},
+		{"bidi override content", viewer, `createPost(input: {userID: $user, content: "\u202e"}) { userErrors { field message } }`, map[string]interface{}{"user": userID}, []string{"input", "content"}, "blank"},
+		{"control characters", viewer, `createUser(input: {name: "a\u0007b"}) { userErrors { field message } }`, nil, []string{"input", "name"}, "control characters"},
+		{"long name", viewer, `createUser(input: {name: "` + strings.Repeat("a", 101) + `"}) { userErrors { field message } }`, nil, []string{"input", "name"}, "at most 100"},
+		{"blank content", viewer, `createPost(input: {userID: $user, content: ""}) { userErrors { field message } }`, map[string]interface{}{"user": userID}, []string{"input", "content"}, "blank"},
+		{"unknown author", auth.Viewer{Admin: true}, `createPost(input: {userID: $user, content: "Hi"}) { userErrors { field message } }`, map[string]interface{}{"user": "999999"}, []string{"input", "userID"}, "not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := `mutation { ` + test.mutation + ` }`
+			if test.variables != nil {
+				operation = `mutation($user: UserID!) { ` + test.mutation + ` }`
+			}
+			checkUserError(t, runQuery(t, server, test.viewer, operation, test.variables), test.wantField, test.wantIn)
+		})
+	}
+
+	t.Run("format characters stripped", func(t *testing.T) {
+		resp := runQuery(t, server, viewer, `mutation($name: String!) { createUser(input: {name: $name}) { user { name } } }`,
+			map[string]interface{}{"name": "\u202eA\u200bnn \U0001F469\u200d\U0001F4BB"})
+		var data struct {
+			CreateUser struct{ User struct{ Name string } }
+		}
+		resp.decode(t, &data)
+		if want := "Ann \U0001F469\u200d\U0001F4BB"; data.CreateUser.User.Name != want {
+			t.Errorf("name = %+q, want %+q", data.CreateUser.User.Name, want)
+		}
+	})
+}
+
+func TestIDArguments(t *testing.T) {
+	server := newTestServer(t)
+	ann := seedUser(t, "Ann")
+	tests := []struct {
+		name     string
+		query    string
+		id       string
+		wantCode string // empty when Ann is found
+	}{
+		{"global ID", `query($id: UserID!) { user(id: $id) { name } }`, resolvers.GlobalID(resolvers.UserNode, ann.ID), ""},
+		{"legacy numeric ID", `query($id: UserID!) { user(id: $id) { name } }`, ann.ID, ""},
+		{"bad base64", `query($id: UserID!) { user(id: $id) { name } }`, "%%%", "BAD_REQUEST"},
+		{"bad base64 literal", `{ user(id: "%%%") { name } }`, "", "BAD_REQUEST"},
+		{"Post ID as a UserID", `query($id: UserID!) { user(id: $id) { name } }`, resolvers.GlobalID(resolvers.PostNode, ann.ID), "BAD_REQUEST"},
+		{"Post ID literal as a UserID", `{ user(id: "` + resolvers.GlobalID(resolvers.PostNode, ann.ID) + `") { name } }`, "", "BAD_REQUEST"},
+		{"User ID as a PostID", `mutation($id: PostID!) { deletePost(input: {id: $id}) { post { id } } }`, resolvers.GlobalID(resolvers.UserNode, ann.ID), "BAD_REQUEST"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var variables map[string]interface{}
+			if test.id != "" {
+				variables = map[string]interface{}{"id": test.id}
+			}
+			resp := runQuery(t, server, auth.Viewer{}, test.query, variables)
+			if test.wantCode == "" {
+				if len(resp.Errors) > 0 || !strings.Contains(string(resp.Data), `"name":"Ann"`) {
+					t.Errorf("response = %s %+v, want Ann", resp.Data, resp.Errors)
+				}
+				return
+			}
+			if resp.code() != test.wantCode || !strings.Contains(resp.Errors[0].Message, "invalid value") {
+				t.Errorf("code = %q (errors %+v), want %s about an invalid value", resp.code(), resp.Errors, test.wantCode)
+			}
+		})
+	}
+}
+
+// checkUserError checks that resp holds the single user error of a mutation, about field
+func checkUserError(t *testing.T, resp gqlResponse, field []string, message string) {
+	t.Helper()
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors: %+v", resp.Errors)
+	}
+	var data map[string]struct {
+		UserErrors []struct {
+			Field   []string
+			Message string
+		}
+	}
+	resp.decode(t, &data)
+	for _, payload := range data {
+		if len(payload.UserErrors) != 1 {
+			t.Fatalf("userErrors = %+v, want one", payload.UserErrors)
+		}
+		userError := payload.UserErrors[0]
+		if !reflect.DeepEqual(userError.Field, field) || !strings.Contains(userError.Message, message) {
+			t.Errorf("userError = %+v, want field %v and a message containing %q", userError, field, message)
+		}
+	}
+}
+
+func TestComplexityLimits(t *testing.T) {
+	server := newTestServer(t)
+	defer func(depth, cost int) { maxQueryDepth, maxQueryCost = depth, cost }(maxQueryDepth, maxQueryCost)
+	maxQueryDepth, maxQueryCost = 5, 50
+	var ids []string // authors of the posts lists filtered by userIDs
+	for _, name := range []string{"Ann", "Bob", "Cid", "Dee", "Eve"} {
+		ids = append(ids, resolvers.GlobalID(resolvers.UserNode, seedUser(t, name).ID))
+	}
+	nodeIDs := make([]string, 60)
+	for i := range nodeIDs {
+		nodeIDs[i] = ids[0]
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode string
+		wantCost float64
+	}{
+		{"within the limits", `{ posts(first: 5) { nodes { author { name } } } }`, "", 10},
+		{"too deep", `{ posts(first: 1) { nodes { author { posts(first: 1) { nodes { content } } } } } }`, "QUERY_TOO_COMPLEX", 3},
+		{"too costly", `{ users(first: 30) { nodes { posts(first: 1) { nodes { content } } } } }`, "QUERY_TOO_COMPLEX", 60},
+		{"nested lists multiply", `{ users(first: 5) { nodes { posts(first: 10) { nodes { author { name } } } } } }`, "QUERY_TOO_COMPLEX", 105},
+		{"lists pay for their nodes", `{ posts(first: 100000000) { nodes { content } } }`, "QUERY_TOO_COMPLEX", 100000000},
+		{"lists pay for the nodes they skip", `{ posts(limit: 1, offset: 100000000) { nodes { content } } }`, "QUERY_TOO_COMPLEX", 100000001},
+		{"nodes pay for their ids", `query($nodeIDs: [NodeID!]!) { nodes(ids: $nodeIDs) { id } }`, "QUERY_TOO_COMPLEX", 60},
+		{"unbounded lists hold a page", `{ posts { nodes { content } } }`, "QUERY_TOO_COMPLEX", 100},
+		{"authors multiply", `query($ids: [UserID!]) { posts(userIDs: $ids, first: 3) { nodes { author { name } } } }`, "", 30},
+		{"authors multiply past the limit", `query($ids: [UserID!]) { posts(userIDs: $ids, first: 10) { nodes { author { name } } } }`, "QUERY_TOO_COMPLEX", 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := runQuery(t, server, auth.Viewer{}, test.query, map[string]interface{}{"ids": ids, "nodeIDs": nodeIDs})
+			if resp.code() != test.wantCode {
+				t.Fatalf("code = %q, want %q (errors %+v)", resp.code(), test.wantCode, resp.Errors)
+			}
+			extensions := resp.Extensions
+			if test.wantCode != "" {
+				extensions = resp.Errors[0].Extensions
+			}
+			measure, _ := extensions["complexity"].(map[string]interface{})
+			if measure["cost"] != test.wantCost {
+				t.Errorf("complexity = %v, want a cost of %v", measure, test.wantCost)
+			}
+		})
+	}
+}
+
+func TestDefaultPageSize(t *testing.T) {
+	server := newTestServer(t)
+	contents := make([]string, resolvers.DefaultPageSize+1)
+	for i := range contents {
+		contents[i] = fmt.Sprintf("p%d", i)
+	}
+	ann := seedUser(t, "Ann", contents...)
+	seedUser(t, "Bob", "b1")
+	annID := resolvers.GlobalID(resolvers.UserNode, ann.ID)
+
+	for _, args := range []string{"", fmt.Sprintf(`(userIDs: [%q])`, annID)} {
+		resp := runQuery(t, server, auth.Viewer{}, `{ posts`+args+` { nodes { content } pageInfo { hasNextPage } } }`, nil)
+		if len(resp.Errors) > 0 {
+			t.Fatalf("posts%s: errors: %+v", args, resp.Errors)
+		}
+		var data struct{ Posts postList }
+		resp.decode(t, &data)
+		if len(data.Posts.Nodes) != resolvers.DefaultPageSize || !data.Posts.PageInfo.HasNextPage {
+			t.Errorf("posts%s = %d posts and hasNextPage %v, want %d and true", args, len(data.Posts.Nodes), data.Posts.PageInfo.HasNextPage, resolvers.DefaultPageSize)
+		}
+	}
+
+	for _, args := range []string{"first: 101", "last: 101", "limit: 101"} {
+		resp := runQuery(t, server, auth.Viewer{}, `{ posts(`+args+`) { nodes { content } } }`, nil)
+		if resp.code() != "INVALID_ARGUMENT" {
+			t.Errorf("posts(%s): code = %q, want INVALID_ARGUMENT (errors %+v)", args, resp.code(), resp.Errors)
+		}
+	}
+}
+
+func TestCreateUserToken(t *testing.T) {
+	server := newTestServer(t)
+	resp := runQuery(t, server, auth.Viewer{}, `mutation { createUser(input: {name: "Ann"}) { user { id } token } }`, nil)
+	var created struct {
+		CreateUser struct {
+			User  struct{ ID string }
+			Token string
+		}
+	}
+	resp.decode(t, &created)
+	if created.CreateUser.Token == "" {
+		t.Fatalf("createUser = %s, want a token", resp.Data)
+	}
+	status, body := postJSON(t, server, created.CreateUser.Token, map[string]interface{}{
+		"query":     `mutation($user: UserID!) { createPost(input: {userID: $user, content: "Hi!"}) { post { content } } }`,
+		"variables": map[string]interface{}{"user": created.CreateUser.User.ID},
+	})
+	if status != http.StatusOK || strings.Contains(string(body), `"errors"`) {
+		t.Errorf("createPost with the token of createUser = %d %s, want the post", status, body)
+	}
+
+	tokenSigner = nil // a server without AUTH_SECRET
+	resp = runQuery(t, server, auth.Viewer{}, `mutation { createUser(input: {name: "Bob"}) { token } }`, nil)
+	if !strings.Contains(string(resp.Data), `"token":null`) {
+		t.Errorf("createUser without AUTH_SECRET = %s, want a null token", resp.Data)
+	}
+}
+
+func TestAnonymousPosts(t *testing.T) {
+	server := newTestServer(t)
+	ann, eve := seedUser(t, "Ann"), seedUser(t, "Eve")
+	defer func() { resolvers.AnonymousPosts = false }()
+	resolvers.AnonymousPosts = true
+
+	const createPost = `mutation($user: UserID!) { createPost(input: {userID: $user, content: "Hi!"}) { post { content } } }`
+	variables := map[string]interface{}{"user": resolvers.GlobalID(resolvers.UserNode, ann.ID)}
+	if resp := runQuery(t, server, auth.Viewer{}, createPost, variables); len(resp.Errors) > 0 {
+		t.Errorf("anonymous createPost: errors %+v, want the post", resp.Errors)
+	}
+	if resp := runQuery(t, server, auth.Viewer{UserID: eve.ID}, createPost, variables); resp.code() != "FORBIDDEN" {
+		t.Errorf("createPost as another user: code %q, want FORBIDDEN", resp.code())
+	}
+}
+
+// failingQueue is a task queue that is down
+type failingQueue struct{}
+
+// Enqueue function
+func (failingQueue) Enqueue(ctx context.Context, name, arg string) error {
+	return errors.New("queue unavailable")
+}
+
+func TestDeleteUserWithoutQueue(t *testing.T) {
+	server := newTestServer(t)
+	contents := make([]string, store.MaxBatchSize+1) // more than deleteUser removes right away
+	for i := range contents {
+		contents[i] = "Hi!"
+	}
+	ann := seedUser(t, "Ann", contents...)
+	dataBackend.tasks = failingQueue{}
+
+	resp := runQuery(t, server, auth.Viewer{UserID: ann.ID}, `mutation($user: UserID!) { deleteUser(input: {id: $user}) { user { name } } }`,
+		map[string]interface{}{"user": resolvers.GlobalID(resolvers.UserNode, ann.ID)})
+	if len(resp.Errors) > 0 || !strings.Contains(string(resp.Data), `"name":"Ann"`) {
+		t.Errorf("deleteUser = %s %+v, want the deleted user", resp.Data, resp.Errors)
+	}
+	if _, err := dataBackend.store.GetUser(context.Background(), ann.ID); err != store.ErrNotFound {
+		t.Errorf("user after deleteUser: %v, want ErrNotFound", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	server := newTestServer(t)
+	seedUser(t, "Ann", "Hi!")
+	defer func(size int) { maxBatchSize = size }(maxBatchSize)
+	maxBatchSize = 3
+
+	status, body := postJSON(t, server, "", []map[string]interface{}{
+		{"query": `{ users(first: 5) { nodes { name } } }`},
+		{"query": `{ posts(first: 5) { nodes { content } } }`},
+		{"query": `{ posts(first: 5, after: "nonsense") { nodes { content } } }`},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", status, http.StatusOK, body)
+	}
+	var results []gqlResponse
+	if err := json.Unmarshal(body, &results); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	var users struct {
+		Users struct{ Nodes []struct{ Name string } }
+	}
+	results[0].decode(t, &users)
+	if len(users.Users.Nodes) != 1 || users.Users.Nodes[0].Name != "Ann" {
+		t.Errorf("first result = %s, want the users", results[0].Data)
+	}
+	var posts struct{ Posts postList }
+	results[1].decode(t, &posts)
+	if got := posts.Posts.contents(); !reflect.DeepEqual(got, []string{"Hi!"}) {
+		t.Errorf("second result = %s, want the posts", results[1].Data)
+	}
+	if results[2].code() != "INVALID_ARGUMENT" {
+		t.Errorf("third result errors = %+v, want INVALID_ARGUMENT", results[2].Errors)
+	}
+
+	status, body = postJSON(t, server, "", []map[string]interface{}{
+		{"query": `{ users { nodes { name } } }`}, {"query": `{ users { nodes { name } } }`},
+		{"query": `{ users { nodes { name } } }`}, {"query": `{ users { nodes { name } } }`},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("status of a batch too large = %d, want %d: %s", status, http.StatusBadRequest, body)
+	}
+
+	defer func(cost int) { maxQueryCost = cost }(maxQueryCost)
+	maxQueryCost = 25
+	status, body = postJSON(t, server, "", []map[string]interface{}{ // 10 each, within the limit on their own
+		{"query": `{ posts(first: 10) { nodes { content } } }`},
+		{"query": `{ posts(first: 10) { nodes { content } } }`},
+		{"query": `{ posts(first: 10) { nodes { content } } }`},
+	})
+	var resp gqlResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	if status != http.StatusBadRequest || resp.code() != "QUERY_TOO_COMPLEX" {
+		t.Errorf("batch over the cost limit = %d %s, want %d and QUERY_TOO_COMPLEX", status, body, http.StatusBadRequest)
+	}
+	if measure, _ := resp.Errors[0].Extensions["complexity"].(map[string]interface{}); measure["cost"] != float64(30) {
+		t.Errorf("complexity = %v, want a cost of 30", measure)
+	}
+}
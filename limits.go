@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/complexity"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/resolvers"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/pkg/errors"
+)
+
+var maxQueryDepth = 10  // declare the deepest nesting of fields an operation may have, 0 for no limit
+var maxQueryCost = 1000 // declare the highest cost an operation may have, 0 for no limit
+var maxBatchSize = 20   // declare the largest number of operations a batch may hold, 0 for no limit
+
+var maxConnectionOperations = 100 // declare the largest number of operations a WebSocket connection may run at once, 0 for no limit
+
+// pageCost is the cost of a list field, a store query reading every node it skips or returns, whose nodes
+// resolve as many times as they are asked for
+var pageCost = complexity.Field{Cost: 1, Multipliers: []string{"first", "last", "limit"}, DefaultMultiplier: resolvers.DefaultPageSize, Offsets: []string{"offset"}}
+
+// postsCost is the cost of the posts list, which runs its query and its count once per author of `userIDs`
+var postsCost = complexity.Field{Cost: pageCost.Cost, Multipliers: pageCost.Multipliers, DefaultMultiplier: pageCost.DefaultMultiplier, Offsets: pageCost.Offsets, Fanouts: []string{"userIDs"}}
+
+// fieldCosts are the costs of the fields reading or writing storage, other fields cost nothing
+var fieldCosts = complexity.Costs{
+	"RootQuery.node":        {Cost: 1},
+	"RootQuery.nodes":       {Cost: 1, Multipliers: []string{"ids"}},
+	"RootQuery.user":        {Cost: 1},
+	"RootQuery.users":       pageCost,
+	"RootQuery.posts":       postsCost,
+	"RootQuery.searchPosts": {Cost: 2, Multipliers: []string{"first"}, DefaultMultiplier: 10}, // a search, then a batch read of the posts
+	"User.posts":            pageCost,
+	"Post.author":           {Cost: 1},
+
+	"rootFieldsUserList.totalCount":   {Cost: 1}, // counting runs a query of its own
+	"rootFieldsPostList.totalCount":   {Cost: 1},
+	"userTypePostList.totalCount":     {Cost: 1},
+	"rootFieldsPostSearch.totalCount": {Cost: 1},
+
+	"RootMutation.createUser": {Cost: 10}, // writes run in a transaction, one after the other
+	"RootMutation.updateUser": {Cost: 10},
+	"RootMutation.deleteUser": {Cost: 50}, // also deletes the posts of the user
+	"RootMutation.createPost": {Cost: 10},
+	"RootMutation.updatePost": {Cost: 10},
+	"RootMutation.deletePost": {Cost: 10},
+
+	"RootSubscription.postCreated": {Cost: 1},
+	"RootSubscription.postUpdated": {Cost: 1},
+	"RootSubscription.postDeleted": {Cost: 1},
+}
+
+// configureLimits overrides the depth, cost, batch size and connection limits with QUERY_MAX_DEPTH,
+// QUERY_MAX_COST, QUERY_MAX_BATCH_SIZE and QUERY_MAX_CONNECTION_OPERATIONS, when set
+func configureLimits() error {
+	limits := map[string]*int{
+		"QUERY_MAX_DEPTH":                 &maxQueryDepth,
+		"QUERY_MAX_COST":                  &maxQueryCost,
+		"QUERY_MAX_BATCH_SIZE":            &maxBatchSize,
+		"QUERY_MAX_CONNECTION_OPERATIONS": &maxConnectionOperations,
+	}
+	for name, limit := range limits {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return errors.Errorf("%s must be a number, 0 for no limit", name)
+		}
+		*limit = n
+	}
+	return nil
+}
+
+// checkLimits returns the result turning down an operation nested too deep or costing too much, nil when it may run
+func checkLimits(measure complexity.Measure) *graphql.Result {
+	var message string
+	switch {
+	case maxQueryDepth > 0 && measure.Depth > maxQueryDepth:
+		message = fmt.Sprintf("The operation is nested %d fields deep, more than the limit of %d", measure.Depth, maxQueryDepth)
+	case maxQueryCost > 0 && measure.Cost > maxQueryCost:
+		message = fmt.Sprintf("The operation costs %d, more than the limit of %d", measure.Cost, maxQueryCost)
+	default:
+		return nil
+	}
+	formatted := gqlerrors.NewFormattedError(message)
+	formatted.Extensions = map[string]interface{}{"code": apperrors.QueryTooComplex}
+	for key, value := range complexityExtensions(measure) {
+		formatted.Extensions[key] = value
+	}
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}}
+}
+
+// complexityExtensions returns the `extensions` entries reporting the measure of an operation
+func complexityExtensions(measure complexity.Measure) map[string]interface{} {
+	return map[string]interface{}{
+		"complexity": map[string]interface{}{
+			"depth":    measure.Depth,
+			"cost":     measure.Cost,
+			"maxDepth": maxQueryDepth,
+			"maxCost":  maxQueryCost,
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errFetchFailed is the result of keys whose fetch did not complete
+var errFetchFailed = errors.New("loaders: fetch failed")
+
+// result is the outcome of loading one key
+type result struct {
+	value interface{}
+	err   error
+}
+
+// entry is a key that was asked for, and its result once the batch it belongs to ran
+type entry struct {
+	done   chan struct{}
+	result result
+}
+
+// batch collects keys until one of its thunks runs, then fetches them together.
+// Keys must be comparable, results are cached for the lifetime of the batch.
+type batch struct {
+	fetch func(ctx context.Context, keys []interface{}) []result
+
+	mu      sync.Mutex
+	entries map[interface{}]*entry
+	pending []interface{}
+}
+
+// newBatch function
+func newBatch(fetch func(ctx context.Context, keys []interface{}) []result) *batch {
+	return &batch{fetch: fetch, entries: map[interface{}]*entry{}}
+}
+
+// load registers key and returns a thunk that waits for its result
+func (b *batch) load(ctx context.Context, key interface{}) func() (interface{}, error) {
+	b.mu.Lock()
+	e, ok := b.entries[key]
+	if !ok {
+		e = &entry{done: make(chan struct{})}
+		b.entries[key] = e
+		b.pending = append(b.pending, key)
+	}
+	b.mu.Unlock()
+
+	return func() (interface{}, error) {
+		b.dispatch(ctx)
+		<-e.done
+		return e.result.value, e.result.err
+	}
+}
+
+// dispatch fetches every pending key, when there are any
+func (b *batch) dispatch(ctx context.Context) {
+	b.mu.Lock()
+	keys := b.pending
+	b.pending = nil
+	entries := make([]*entry, len(keys))
+	for i, key := range keys {
+		entries[i] = b.entries[key]
+	}
+	b.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+
+	results := make([]result, len(keys))
+	defer func() { // release the waiters even when fetch panics
+		for i, e := range entries {
+			e.result = results[i]
+			close(e.done)
+		}
+	}()
+	for i := range results {
+		results[i].err = errFetchFailed
+	}
+	copy(results, b.fetch(ctx, keys))
+}
+
+// forget drops the cached result of key
+func (b *batch) forget(key interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.entries[key]; ok && isDone(e) {
+		delete(b.entries, key)
+	}
+}
+
+// forgetAll drops every cached result
+func (b *batch) forgetAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, e := range b.entries {
+		if isDone(e) {
+			delete(b.entries, key)
+		}
+	}
+}
+
+// isDone reports whether the result of e is known
+func isDone(e *entry) bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,166 @@
+package loaders
+
+import (
+	"context"
+	"sync"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+)
+
+// Loaders batch the store reads of a single request. Resolvers ask for a key
+// and get a thunk back, graphql-go resolves every field of a level before it
+// runs their thunks, so the first thunk to run fetches every key collected so far.
+type Loaders struct {
+	users      *batch
+	posts      *batch
+	postPages  *batch
+	postCounts *batch
+}
+
+// New returns empty loaders, to be shared by the operations of one request
+func New() *Loaders {
+	return &Loaders{
+		users:      newBatch(fetchUsers),
+		posts:      newBatch(fetchPosts),
+		postPages:  newBatch(fetchPostPages),
+		postCounts: newBatch(fetchPostCounts),
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l
+func NewContext(ctx context.Context, l *Loaders) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Loaders carried by ctx, or fresh ones
+func FromContext(ctx context.Context) *Loaders {
+	if l, ok := ctx.Value(contextKey{}).(*Loaders); ok {
+		return l
+	}
+	return New()
+}
+
+// User returns a thunk yielding the user with the given id, or store.ErrNotFound
+func (l *Loaders) User(ctx context.Context, id string) func() (*m.User, error) {
+	thunk := l.users.load(ctx, id)
+	return func() (*m.User, error) {
+		value, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		return value.(*m.User), nil
+	}
+}
+
+// Post returns a thunk yielding the post with the given id, or store.ErrNotFound
+func (l *Loaders) Post(ctx context.Context, id string) func() (*m.Post, error) {
+	thunk := l.posts.load(ctx, id)
+	return func() (*m.Post, error) {
+		value, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		return value.(*m.Post), nil
+	}
+}
+
+// PostPage returns a thunk yielding the page of posts described by query
+func (l *Loaders) PostPage(ctx context.Context, query store.PostQuery) func() (store.PostPage, error) {
+	thunk := l.postPages.load(ctx, query)
+	return func() (store.PostPage, error) {
+		value, err := thunk()
+		if err != nil {
+			return store.PostPage{}, err
+		}
+		return value.(store.PostPage), nil
+	}
+}
+
+// PostCount returns a thunk yielding the number of posts matching query
+func (l *Loaders) PostCount(ctx context.Context, query store.PostQuery) func() (int, error) {
+	thunk := l.postCounts.load(ctx, query)
+	return func() (int, error) {
+		value, err := thunk()
+		if err != nil {
+			return 0, err
+		}
+		return value.(int), nil
+	}
+}
+
+// ForgetUser drops a cached user, after it was written
+func (l *Loaders) ForgetUser(id string) {
+	l.users.forget(id)
+}
+
+// ForgetPosts drops every cached post, page and count of posts, after a post was written
+func (l *Loaders) ForgetPosts() {
+	l.posts.forgetAll()
+	l.postPages.forgetAll()
+	l.postCounts.forgetAll()
+}
+
+// fetchUsers loads users with a single multi-get, or one by one when an id is malformed
+func fetchUsers(ctx context.Context, keys []interface{}) []result {
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = key.(string)
+	}
+	users, err := store.FromContext(ctx).GetUsers(ctx, ids)
+	if err == store.ErrInvalidID { // a malformed id, such as the UserID of a legacy post, spoils the batch
+		return fetchConcurrently(keys, func(key interface{}) (interface{}, error) {
+			return store.FromContext(ctx).GetUser(ctx, key.(string))
+		})
+	}
+	results := make([]result, len(keys))
+	for i := range results {
+		switch {
+		case err != nil:
+			results[i].err = err
+		case users[i] == nil:
+			results[i].err = store.ErrNotFound
+		default:
+			results[i].value = users[i]
+		}
+	}
+	return results
+}
+
+// fetchPosts loads posts concurrently, their keys depend on the author so they cannot be fetched with a multi-get
+func fetchPosts(ctx context.Context, keys []interface{}) []result {
+	return fetchConcurrently(keys, func(key interface{}) (interface{}, error) {
+		return store.FromContext(ctx).GetPost(ctx, key.(string))
+	})
+}
+
+// fetchPostPages runs the page queries concurrently, the datastore has no way to batch them
+func fetchPostPages(ctx context.Context, keys []interface{}) []result {
+	return fetchConcurrently(keys, func(key interface{}) (interface{}, error) {
+		return store.FromContext(ctx).ListPosts(ctx, key.(store.PostQuery))
+	})
+}
+
+// fetchPostCounts runs the count queries concurrently
+func fetchPostCounts(ctx context.Context, keys []interface{}) []result {
+	return fetchConcurrently(keys, func(key interface{}) (interface{}, error) {
+		return store.FromContext(ctx).CountPosts(ctx, key.(store.PostQuery))
+	})
+}
+
+// fetchConcurrently calls fetch for every key at once
+func fetchConcurrently(keys []interface{}, fetch func(key interface{}) (interface{}, error)) []result {
+	results := make([]result, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key interface{}) {
+			defer wg.Done()
+			results[i].value, results[i].err = fetch(key)
+		}(i, key)
+	}
+	wg.Wait()
+	return results
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/complexity"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/loaders"
 	"github.com/damilarelana/goGraphQLGoogleAppEngine/middleware"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
 	"github.com/damilarelana/goGraphQLGoogleAppEngine/resolvers"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/validate"
 	"github.com/gorilla/mux"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
 	"github.com/pkg/errors"
 	"google.golang.org/appengine"
 )
@@ -19,24 +28,80 @@ import (
 var muxRouter = mux.NewRouter().StrictSlash(true) // instantiate the gorillamux Router and enforce trailing slash rule i.e. `/path` === `/path/`
 
 // Global declaration of schema and err
-var schema graphql.Schema // declare GraphQL schema to allow access in other functions
-var err error             // declare global error variable
+var schema graphql.Schema    // declare GraphQL schema to allow access in other functions
+var dataBackend backend      // declare the storage shared by every request
+var tokenSigner *auth.Signer // declare the verifier of bearer tokens, nil when AUTH_SECRET is unset
+var err error                // declare global error variable
+
+// makeIDScalar function builds the type of ID arguments, decode returns the value resolvers get,
+// or nil for a malformed ID, which rejects the document while it is validated
+func makeIDScalar(name, description string, decode func(string) interface{}) *graphql.Scalar {
+	return graphql.NewScalar(graphql.ScalarConfig{
+		Name:        name,
+		Description: description,
+		Serialize: func(value interface{}) interface{} {
+			return fmt.Sprint(value)
+		},
+		ParseValue: func(value interface{}) interface{} {
+			if id, ok := value.(string); ok {
+				return decode(id)
+			}
+			return nil
+		},
+		ParseLiteral: func(valueAST ast.Value) interface{} {
+			switch valueAST := valueAST.(type) {
+			case *ast.StringValue:
+				return decode(valueAST.Value)
+			case *ast.IntValue: // legacy numeric IDs may be written unquoted
+				return decode(valueAST.Value)
+			}
+			return nil
+		},
+	})
+}
+
+var userIDType = makeIDScalar("UserID", "The global ID of a User, or its legacy numeric ID", func(id string) interface{} { // declare GraphQL userIDType
+	return resolvers.DecodeID(resolvers.UserNode, id)
+})
+
+var postIDType = makeIDScalar("PostID", "The global ID of a Post, or its legacy numeric ID", func(id string) interface{} { // declare GraphQL postIDType
+	return resolvers.DecodeID(resolvers.PostNode, id)
+})
+
+var nodeIDType = makeIDScalar("NodeID", "The global ID of any Node", resolvers.DecodeNodeID) // declare GraphQL nodeIDType
+
+var nodeInterface = graphql.NewInterface(graphql.InterfaceConfig{ // declare GraphQL nodeInterface, for objects that can be refetched by id
+	Name: "Node",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+	},
+})
 
 var userType = graphql.NewObject(graphql.ObjectConfig{ // declare GraphQL userType
-	Name: "User",
+	Name:       "User",
+	Interfaces: []*graphql.Interface{nodeInterface},
+	IsTypeOf: func(p graphql.IsTypeOfParams) bool {
+		return resolvers.NodeType(p.Value) == resolvers.UserNode
+	},
 	Fields: graphql.Fields{
-		"id":    &graphql.Field{Type: graphql.String},
-		"name":  &graphql.Field{Type: graphql.String},
-		"posts": makeListField(makeNodeListType("userTypePostList", postType), resolvers.QueryPostsByUser),
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolvers.ResolveUserID},
+		"name":      &graphql.Field{Type: graphql.String},
+		"createdAt": &graphql.Field{Type: graphql.DateTime, Resolve: resolvers.ResolveUserCreatedAt},
+		"posts":     makePostsField("userTypePostList", resolvers.QueryPostsByUser),
 	},
 })
 
 var postType = graphql.NewObject(graphql.ObjectConfig{ // declare GraphQL postType
-	Name: "Post",
+	Name:       "Post",
+	Interfaces: []*graphql.Interface{nodeInterface},
+	IsTypeOf: func(p graphql.IsTypeOfParams) bool {
+		return resolvers.NodeType(p.Value) == resolvers.PostNode
+	},
 	Fields: graphql.Fields{
-		"id":        &graphql.Field{Type: graphql.String},
-		"userID":    &graphql.Field{Type: graphql.String},
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolvers.ResolvePostID},
+		"userID":    &graphql.Field{Type: graphql.ID, Resolve: resolvers.ResolvePostUserID},
 		"createdAt": &graphql.Field{Type: graphql.DateTime},
+		"updatedAt": &graphql.Field{Type: graphql.DateTime, Resolve: resolvers.ResolvePostUpdatedAt},
 		"content":   &graphql.Field{Type: graphql.String},
 	},
 })
@@ -44,26 +109,84 @@ var postType = graphql.NewObject(graphql.ObjectConfig{ // declare GraphQL postTy
 //
 // Mutation
 //
-var mutationFields = graphql.Fields{ // declare mutation fields: for user, post etc.
+var userErrorType = graphql.NewObject(graphql.ObjectConfig{ // declare GraphQL userErrorType
+	Name: "UserError",
+	Fields: graphql.Fields{
+		"field":   &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"message": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
 
-	// createUser fields
-	"createUser": &graphql.Field{
-		Type: userType,
+// makeMutationField function builds a mutation taking a single `name + Input` argument,
+// and returning a `name + Payload` with the clientMutationId, the entity and the user errors
+func makeMutationField(name string, inputFields graphql.InputObjectConfigFieldMap, entityName string, entityType *graphql.Object, resolve graphql.FieldResolveFn) *graphql.Field {
+	inputFields["clientMutationId"] = &graphql.InputObjectFieldConfig{Type: graphql.String}
+	inputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   name + "Input",
+		Fields: inputFields,
+	})
+	payloadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Payload",
+		Fields: graphql.Fields{
+			"clientMutationId": &graphql.Field{Type: graphql.String},
+			entityName:         &graphql.Field{Type: entityType},
+			"userErrors":       &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userErrorType)))},
+		},
+	})
+	return &graphql.Field{
+		Type: payloadType,
 		Args: graphql.FieldConfigArgument{
-			"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(inputType)},
 		},
-		Resolve: resolvers.CreateUser, // call the resolver `createUser`
-	},
+		Resolve: resolvers.Mutation(resolve),
+	}
+}
+
+// withPayloadFields function adds fields to the payload of a mutation built by makeMutationField
+func withPayloadFields(field *graphql.Field, fields graphql.Fields) *graphql.Field {
+	payloadType := field.Type.(*graphql.Object)
+	for name, payloadField := range fields {
+		payloadType.AddFieldConfig(name, payloadField)
+	}
+	return field
+}
+
+var mutationFields = graphql.Fields{ // declare mutation fields: for user, post etc.
+
+	// createUser fields
+	"createUser": withPayloadFields(makeMutationField("CreateUser", graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	}, "user", userType, resolvers.CreateUser), graphql.Fields{ // call the resolver `createUser`
+		"token": &graphql.Field{Type: graphql.String, Description: "Bearer token acting as the new user, null when the server signs no tokens"},
+	}),
+
+	// updateUser fields
+	"updateUser": makeMutationField("UpdateUser", graphql.InputObjectConfigFieldMap{
+		"id":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(userIDType)},
+		"name": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	}, "user", userType, resolvers.UpdateUser), // call the resolver `updateUser`
+
+	// deleteUser fields
+	"deleteUser": makeMutationField("DeleteUser", graphql.InputObjectConfigFieldMap{
+		"id": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(userIDType)},
+	}, "user", userType, resolvers.DeleteUser), // call the resolver `deleteUser`, which also removes the user's posts
 
 	// createPost fields
-	"createPost": &graphql.Field{
-		Type: postType,
-		Args: graphql.FieldConfigArgument{
-			"userID":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-			"content": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-		},
-		Resolve: resolvers.CreatePost, // call the resolver `createPost`
-	},
+	"createPost": makeMutationField("CreatePost", graphql.InputObjectConfigFieldMap{
+		"userID":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(userIDType)},
+		"content": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	}, "post", postType, resolvers.CreatePost), // call the resolver `createPost`
+
+	// updatePost fields
+	"updatePost": makeMutationField("UpdatePost", graphql.InputObjectConfigFieldMap{
+		"id":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(postIDType)},
+		"content": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	}, "post", postType, resolvers.UpdatePost), // call the resolver `updatePost`, only the author or an admin may edit
+
+	// deletePost fields
+	"deletePost": makeMutationField("DeletePost", graphql.InputObjectConfigFieldMap{
+		"id": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(postIDType)},
+	}, "post", postType, resolvers.DeletePost), // call the resolver `deletePost`, only the author or an admin may delete
 }
 
 var rootMutation = graphql.NewObject(graphql.ObjectConfig{ // declare rootMutation
@@ -71,6 +194,31 @@ var rootMutation = graphql.NewObject(graphql.ObjectConfig{ // declare rootMutati
 	Fields: mutationFields,
 })
 
+//
+// Subscription
+//
+// makeSubscriptionField function, the field yields the post of every event published on topic
+func makeSubscriptionField(topic string) *graphql.Field {
+	return &graphql.Field{
+		Type: postType,
+		Args: graphql.FieldConfigArgument{
+			"userID": &graphql.ArgumentConfig{Type: userIDType}, // only the posts of this author
+		},
+		Resolve: resolvers.SubscribePost(topic),
+	}
+}
+
+var subscriptionFields = graphql.Fields{ // declare subscription fields, served over /graphql/ws
+	"postCreated": makeSubscriptionField(pubsub.PostCreated),
+	"postUpdated": makeSubscriptionField(pubsub.PostUpdated),
+	"postDeleted": makeSubscriptionField(pubsub.PostDeleted),
+}
+
+var rootSubscription = graphql.NewObject(graphql.ObjectConfig{ // declare rootSubscription
+	Name:   "RootSubscription",
+	Fields: subscriptionFields,
+})
+
 //
 // Query
 //
@@ -80,36 +228,156 @@ func makeListField(listType graphql.Output, resolve graphql.FieldResolveFn) *gra
 		Type:    listType,
 		Resolve: resolve,
 		Args: graphql.FieldConfigArgument{
+			"first":  &graphql.ArgumentConfig{Type: graphql.Int},
+			"after":  &graphql.ArgumentConfig{Type: graphql.String},
+			"last":   &graphql.ArgumentConfig{Type: graphql.Int},
+			"before": &graphql.ArgumentConfig{Type: graphql.String},
 			"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
 			"offset": &graphql.ArgumentConfig{Type: graphql.Int},
 		},
 	}
 }
 
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{ // declare GraphQL pageInfoType
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
 // makeNodeListType function
 func makeNodeListType(name string, nodeType *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: name + "Edge",
+			Fields: graphql.Fields{
+				"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"node":   &graphql.Field{Type: nodeType},
+			},
+		})
 	return graphql.NewObject(
 		graphql.ObjectConfig{
 			Name: name,
 			Fields: graphql.Fields{
 				"nodes":      &graphql.Field{Type: graphql.NewList(nodeType)},
-				"totalCount": &graphql.Field{Type: graphql.Int},
+				"edges":      &graphql.Field{Type: graphql.NewList(edgeType)},
+				"pageInfo":   &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+				"totalCount": &graphql.Field{Type: graphql.Int, Resolve: resolvers.ResolveTotalCount},
 			},
 		})
 }
 
+var orderDirectionType = graphql.NewEnum(graphql.EnumConfig{ // declare GraphQL orderDirectionType
+	Name: "OrderDirection",
+	Values: graphql.EnumValueConfigMap{
+		"ASC":  &graphql.EnumValueConfig{Value: "ASC"},
+		"DESC": &graphql.EnumValueConfig{Value: "DESC"},
+	},
+})
+
+var userOrderType = graphql.NewInputObject(graphql.InputObjectConfig{ // declare GraphQL userOrderType
+	Name: "UserOrder",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.NewEnum(graphql.EnumConfig{
+				Name: "UserOrderField",
+				Values: graphql.EnumValueConfigMap{
+					"NAME":       &graphql.EnumValueConfig{Value: "NAME"},
+					"CREATED_AT": &graphql.EnumValueConfig{Value: "CREATED_AT"},
+				},
+			})),
+		},
+		"direction": &graphql.InputObjectFieldConfig{Type: orderDirectionType, DefaultValue: "ASC"},
+	},
+})
+
+var postOrderType = graphql.NewInputObject(graphql.InputObjectConfig{ // declare GraphQL postOrderType
+	Name: "PostOrder",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.NewEnum(graphql.EnumConfig{
+				Name: "PostOrderField",
+				Values: graphql.EnumValueConfigMap{
+					"CREATED_AT": &graphql.EnumValueConfig{Value: "CREATED_AT"},
+					"UPDATED_AT": &graphql.EnumValueConfig{Value: "UPDATED_AT"},
+				},
+			})),
+		},
+		"direction": &graphql.InputObjectFieldConfig{Type: orderDirectionType, DefaultValue: "DESC"},
+	},
+})
+
+// makePostsField function
+func makePostsField(name string, resolve graphql.FieldResolveFn) *graphql.Field {
+	field := makeListField(makeNodeListType(name, postType), resolve)
+	field.Args["createdAfter"] = &graphql.ArgumentConfig{Type: graphql.DateTime}
+	field.Args["createdBefore"] = &graphql.ArgumentConfig{Type: graphql.DateTime}
+	field.Args["orderBy"] = &graphql.ArgumentConfig{Type: postOrderType}
+	return field
+}
+
+// makeRootPostsField function adds the authors filter, the posts of a user are by that user already
+func makeRootPostsField() *graphql.Field {
+	field := makePostsField("rootFieldsPostList", resolvers.QueryPosts)
+	field.Args["userIDs"] = &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(userIDType))}
+	return field
+}
+
+// makeUsersField function
+func makeUsersField() *graphql.Field {
+	field := makeListField(makeNodeListType("rootFieldsUserList", userType), resolvers.QueryUsers)
+	field.Args["nameStartsWith"] = &graphql.ArgumentConfig{Type: graphql.String}
+	field.Args["orderBy"] = &graphql.ArgumentConfig{Type: userOrderType}
+	return field
+}
+
 var rootFields = graphql.Fields{ // declare query fields.
+	// queryNode field
+	"node": &graphql.Field{
+		Type: nodeInterface,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(nodeIDType)},
+		},
+		Resolve: resolvers.QueryNode, // call the resolver `queryNode`, null when there is no such node
+	},
+
+	// queryNodes field
+	"nodes": &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(nodeInterface)),
+		Args: graphql.FieldConfigArgument{
+			"ids": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(nodeIDType)))},
+		},
+		Resolve: resolvers.QueryNodes, // call the resolver `queryNodes`, the nodes come in the order of the ids
+	},
+
 	// queryUser field
 	"user": &graphql.Field{
 		Type: userType,
 		Args: graphql.FieldConfigArgument{
-			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(userIDType)},
 		},
 		Resolve: resolvers.QueryUser, // call the resolver `queryUser`
 	},
 
+	// queryUsers field
+	"users": makeUsersField(),
+
 	// queryPost field
-	"posts": makeListField(makeNodeListType("rootFieldsPostList", postType), resolvers.QueryPosts),
+	"posts": makeRootPostsField(),
+
+	// querySearchPosts field
+	"searchPosts": &graphql.Field{
+		Type: makeNodeListType("rootFieldsPostSearch", postType),
+		Args: graphql.FieldConfigArgument{
+			"query": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"first": &graphql.ArgumentConfig{Type: graphql.Int},
+			"after": &graphql.ArgumentConfig{Type: graphql.String},
+		},
+		Resolve: resolvers.QuerySearchPosts, // call the resolver `querySearchPosts`, the newest matching posts first
+	},
 }
 
 var rootQuery = graphql.NewObject(graphql.ObjectConfig{ // declare rootQuery
@@ -120,9 +388,14 @@ var rootQuery = graphql.NewObject(graphql.ObjectConfig{ // declare rootQuery
 // Initialization
 // nit builds the schema and maps it to an endpoint handler
 func init() {
+	postType.AddFieldConfig("author", &graphql.Field{ // added here as userType and postType refer to each other
+		Type:    userType,
+		Resolve: resolvers.QueryPostAuthor, // call the resolver `queryPostAuthor`
+	})
 	schemaConfig := graphql.SchemaConfig{
-		Query:    rootQuery,
-		Mutation: rootMutation,
+		Query:        rootQuery,
+		Mutation:     rootMutation,
+		Subscription: rootSubscription,
 	}
 	schema, err = graphql.NewSchema(schemaConfig)
 	if err != nil {
@@ -133,37 +406,108 @@ func init() {
 
 // graphQLServerHomeHandler and entry point for Google App Engine
 func graphQLHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
-	var stringOutput string
-
-	switch r.Method {
-	case "POST":
-		body, err := ioutil.ReadAll(r.Body) // Read the query via the request body, assuming a POST request
-		if err != nil {
-			middleware.ResponseError(w, "Invalid request body", http.StatusBadRequest)
-			return
+	viewer, err := tokenSigner.ViewerFromRequest(r) // identify the caller from its bearer token
+	if err != nil {
+		middleware.ResponseError(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	ctx := loaders.NewContext(dataBackend.requestContext(r), loaders.New()) // batch store reads across the request
+	ctx = auth.NewSignerContext(auth.NewContext(ctx, viewer), tokenSigner)
+
+	requests, batched, err := middleware.ParseGraphQLBatch(r) // extract query, variables and operationName from the request
+	if err != nil {
+		status := http.StatusBadRequest
+		if requestErr, ok := err.(*middleware.RequestError); ok {
+			status = requestErr.Status
 		}
-		stringOutput = string(body)
-	case "GET":
-		stringOutput = r.URL.Query().Get("query")
-	default:
-		stringOutput = ""
+		middleware.ResponseError(w, err.Error(), status)
+		return
+	}
+	if batched { // run the operations of a JSON array concurrently, and answer with the array of their results
+		serveBatch(ctx, w, requests)
+		return
 	}
+	request := requests[0]
 
-	queryParams := graphql.Params{ // compose the GraphQL query parameters
-		Schema:        schema,
-		RequestString: stringOutput,
-		Context:       ctx,
+	if err := admitRequest(ctx, &request); err != nil { // resolve persisted queries and enforce the allowlist
+		status, formatted := admissionError(err)
+		middleware.ResponseFormattedError(w, formatted, status)
+		return
 	}
 
-	resp := graphql.Do(queryParams) // execute the GraphQL request
+	if r.Method == http.MethodGet && !allowedOverGET(request, acceptsEventStream(r)) { // links and prefetches must not write
+		w.Header().Set("Allow", http.MethodPost)
+		middleware.ResponseError(w, "Mutations must be sent with POST", http.StatusMethodNotAllowed)
+		return
+	}
 
-	if len(resp.Errors) > 0 { // check for response errors
-		middleware.ResponseError(w, fmt.Sprintf("%+v", resp.Errors), http.StatusBadRequest)
+	if acceptsEventStream(r) { // stream subscriptions, or any operation, as Server-Sent Events
+		serveEventStream(ctx, w, r, request)
 		return
 	}
 
-	middleware.ResponseJSON(w, resp) // return the query result
+	resp := executeOperation(ctx, request) // execute the GraphQL request
+
+	middleware.ResponseGraphQL(w, resp) // return the query result, including partial data and errors
+}
+
+// allowedOverGET reports whether the operation of a GET request may run: queries, and subscriptions streamed
+// to an EventSource, which only sends GET requests. Operations failing to parse are reported when they run.
+func allowedOverGET(request middleware.GraphQLRequest, streaming bool) bool {
+	operation, _, result := parseOperation(request)
+	if result != nil {
+		return true
+	}
+	switch operation.Operation {
+	case ast.OperationTypeQuery:
+		return true
+	case ast.OperationTypeSubscription:
+		return streaming
+	}
+	return false
+}
+
+// executeOperation runs an admitted request once, unless it is nested too deep or costs too much
+func executeOperation(ctx context.Context, request middleware.GraphQLRequest) *graphql.Result {
+	_, measure, result := parseOperation(request)
+	if result != nil {
+		return result
+	}
+	return runOperation(ctx, request, measure)
+}
+
+// runOperation runs a request parseOperation accepted, reporting its measure
+func runOperation(ctx context.Context, request middleware.GraphQLRequest, measure complexity.Measure) *graphql.Result {
+	queryParams := graphql.Params{ // compose the GraphQL query parameters
+		Schema:         schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        ctx,
+	}
+
+	result := doGraphQL(queryParams)
+	result.Extensions = complexityExtensions(measure)
+	return result
+}
+
+// detachedContext keeps the values of a context but is never done
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// doGraphQL function runs graphql.Do with the cancellation of its context detached. When the context
+// ends first, graphql-go returns its result while the resolvers are still writing to it, a data race,
+// and it never stopped the resolvers anyway.
+func doGraphQL(params graphql.Params) *graphql.Result {
+	if params.Context != nil {
+		params.Context = detachedContext{params.Context}
+	}
+	return graphql.Do(params)
 }
 
 // Server Home page handler
@@ -180,13 +524,61 @@ func custom404PageHandler(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, data404Page)
 }
 
+// maxLengthFromEnv overrides the maximum length of rules with the environment variable name, when set
+func maxLengthFromEnv(rules *validate.Rules, name string) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	maxLength, err := strconv.Atoi(value)
+	if err != nil || maxLength < rules.MinLength {
+		return errors.Errorf("%s must be a number of at least %d", name, rules.MinLength)
+	}
+	rules.MaxLength = maxLength
+	return nil
+}
+
 func main() {
+	dataBackend, err = newBackend() // select the storage configured for this deployment
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Failed to configure storage"))
+	}
+	if err = maxLengthFromEnv(&validate.UserName, "USER_NAME_MAX_LENGTH"); err != nil {
+		log.Fatal(err)
+	}
+	if err = maxLengthFromEnv(&validate.PostContent, "POST_CONTENT_MAX_LENGTH"); err != nil {
+		log.Fatal(err)
+	}
+	if err = configureAllowlist(); err != nil {
+		log.Fatal(err)
+	}
+	if err = configureLimits(); err != nil {
+		log.Fatal(err)
+	}
+	if err = dataBackend.reindexInProcess(); err != nil {
+		log.Fatal(errors.Wrap(err, "Failed to index the stored posts"))
+	}
+	if secret := os.Getenv("AUTH_SECRET"); secret != "" {
+		tokenSigner = auth.NewSigner([]byte(secret))
+	}
+	switch os.Getenv("ANONYMOUS_POSTS") {
+	case "":
+	case "allow":
+		resolvers.AnonymousPosts = true
+	default:
+		log.Fatal(`ANONYMOUS_POSTS must be "allow" when set`)
+	}
 	muxRouter.NotFoundHandler = http.HandlerFunc(custom404PageHandler) // customer 404 Page handler scenario
 	muxRouter.HandleFunc("/", graphQLServerHomePageHandler)
 	http.Handle("/", muxRouter) // register the muxRouter with net package. Yes this handles all the routes
 	fmt.Println("GraphQL Server is running ... ")
-	appengine.Main()
-	for {
-		log.Fatal(errors.Wrap(http.ListenAndServe(":8080", muxRouter), "Failed to start GraphQL Server"))
+	if dataBackend.appEngine {
+		appengine.Main() // the legacy runtime serves the default mux and never returns
+		return
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
 	}
+	log.Fatal(errors.Wrap(http.ListenAndServe(":"+port, muxRouter), "Failed to start GraphQL Server"))
 }
@@ -2,18 +2,110 @@ package middleware
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
 )
 
 // ResponseError endpoint handler
 func ResponseError(w http.ResponseWriter, errMsg string, errCode int) {
-	w.Header().Set("Content-Type", "application/json: charset=UFT-8") // set the content header type
-	w.WriteHeader(errCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": errMsg})
+	ResponseFormattedError(w, FormatRequestError(errMsg, errCode), errCode)
+}
+
+// ResponseFormattedError endpoint handler writes a single error with the given HTTP status
+func ResponseFormattedError(w http.ResponseWriter, formatted gqlerrors.FormattedError, status int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8") // set the content header type
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&graphql.Result{
+		Errors: []gqlerrors.FormattedError{formatted},
+	})
 }
 
 // ResponseJSON endpoint handler
 func ResponseJSON(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json: charset=UFT-8") // set the content header type
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8") // set the content header type
 	json.NewEncoder(w).Encode(data)
 }
+
+// ResponseGraphQL endpoint handler writes a spec-shaped `{data, errors}` result
+func ResponseGraphQL(w http.ResponseWriter, result *graphql.Result) {
+	status := FormatResult(result)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8") // set the content header type
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// FormatResult gives every error of result an `extensions.code`, and returns the
+// HTTP status the result is served with
+func FormatResult(result *graphql.Result) int {
+	status := http.StatusOK
+	if result.HasErrors() && result.Data == nil { // the document failed to parse or validate, so nothing was executed
+		status = http.StatusBadRequest
+	}
+	for i := range result.Errors {
+		result.Errors[i] = withErrorCode(result.Errors[i], status)
+	}
+	return status
+}
+
+// FormatRequestError builds the error entry for a request that never reached execution
+func FormatRequestError(errMsg string, status int) gqlerrors.FormattedError {
+	code := apperrors.BadRequest
+	switch status {
+	case http.StatusUnauthorized:
+		code = apperrors.Unauthenticated
+	case http.StatusForbidden:
+		code = apperrors.Forbidden
+	case http.StatusNotFound:
+		code = apperrors.NotFound
+	case http.StatusInternalServerError:
+		code = apperrors.Internal
+	}
+	formatted := gqlerrors.NewFormattedError(errMsg)
+	formatted.Extensions = map[string]interface{}{"code": code}
+	return formatted
+}
+
+// appError digs the *apperrors.Error out of the layers graphql-go wraps resolver errors in
+func appError(err error) *apperrors.Error {
+	for err != nil {
+		switch e := err.(type) {
+		case *apperrors.Error:
+			return e
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// withErrorCode makes sure every error carries an `extensions.code` and logs internal errors
+func withErrorCode(formatted gqlerrors.FormattedError, status int) gqlerrors.FormattedError {
+	appErr := appError(formatted.OriginalError())
+	if appErr != nil && appErr.Err != nil {
+		log.Printf("%s at %v: %v", appErr.Code, formatted.Path, appErr.Err)
+	}
+	if _, ok := formatted.Extensions["code"]; ok {
+		return formatted
+	}
+	code := apperrors.Internal
+	switch {
+	case appErr != nil:
+		code = appErr.Code
+	case status == http.StatusBadRequest:
+		code = apperrors.BadRequest
+	}
+	extensions := map[string]interface{}{"code": code}
+	for key, value := range formatted.Extensions {
+		extensions[key] = value
+	}
+	formatted.Extensions = extensions
+	return formatted
+}
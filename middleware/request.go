@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxRequestBodySize caps how much of a request body is read
+const maxRequestBodySize = 1 << 20
+
+// GraphQLRequest holds the fields of a GraphQL-over-HTTP request envelope
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    RequestExtensions      `json:"extensions"`
+}
+
+// RequestExtensions holds the `extensions` of a request envelope the server understands
+type RequestExtensions struct {
+	PersistedQuery *PersistedQuery `json:"persistedQuery"`
+}
+
+// PersistedQuery identifies the query of a request by its hash, so that clients
+// can leave it out once the server knows it
+type PersistedQuery struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+// RequestError describes why a request envelope could not be parsed
+type RequestError struct {
+	Message string
+	Status  int
+}
+
+// Error function
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+func newRequestError(status int, msg string) *RequestError {
+	return &RequestError{Message: msg, Status: status}
+}
+
+// ParseGraphQLRequest extracts the query, variables and operationName from a request
+func ParseGraphQLRequest(r *http.Request) (GraphQLRequest, error) {
+	requests, batched, err := ParseGraphQLBatch(r)
+	if err == nil && batched {
+		err = newRequestError(http.StatusBadRequest, "Request body must contain a single JSON object")
+	}
+	if err != nil {
+		return GraphQLRequest{}, err
+	}
+	return requests[0], nil
+}
+
+// ParseGraphQLBatch extracts the operations of a request, several of them when its JSON body
+// is an array of envelopes. batched reports whether it was, the results then form an array too.
+func ParseGraphQLBatch(r *http.Request) (requests []GraphQLRequest, batched bool, err error) {
+	switch r.Method {
+	case http.MethodGet:
+		req, err := parseGETRequest(r)
+		return []GraphQLRequest{req}, false, err
+	case http.MethodPost:
+		return parsePOSTRequests(r)
+	default:
+		return nil, false, newRequestError(http.StatusMethodNotAllowed, "Only GET and POST requests are supported")
+	}
+}
+
+// parseGETRequest reads the envelope from the URL query parameters
+func parseGETRequest(r *http.Request) (GraphQLRequest, error) {
+	values := r.URL.Query()
+	req := GraphQLRequest{
+		Query:         values.Get("query"),
+		OperationName: values.Get("operationName"),
+	}
+	if rawVariables := values.Get("variables"); rawVariables != "" {
+		variables, err := decodeVariables([]byte(rawVariables))
+		if err != nil {
+			return req, err
+		}
+		req.Variables = variables
+	}
+	if rawExtensions := values.Get("extensions"); rawExtensions != "" {
+		if err := json.Unmarshal([]byte(rawExtensions), &req.Extensions); err != nil {
+			return req, newRequestError(http.StatusBadRequest, "Extensions must be a JSON object: "+err.Error())
+		}
+	}
+	if req.Query == "" && req.Extensions.PersistedQuery == nil {
+		return req, newRequestError(http.StatusBadRequest, "Missing query parameter")
+	}
+	return req, nil
+}
+
+// parsePOSTRequests reads the envelope, or the array of envelopes, from the request body according to its content type
+func parsePOSTRequests(r *http.Request) ([]GraphQLRequest, bool, error) {
+	var req GraphQLRequest
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxRequestBodySize))
+	if err != nil {
+		return nil, false, newRequestError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	mediaType := "application/graphql" // a bare body has always been treated as the query
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, false, newRequestError(http.StatusBadRequest, "Invalid Content-Type header")
+		}
+	}
+
+	switch mediaType {
+	case "application/json":
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			requests, err := decodeBatch(body)
+			return requests, true, err
+		}
+		if err := decodeEnvelope(body, &req); err != nil {
+			return nil, false, err
+		}
+	case "application/graphql", "text/plain":
+		req.Query = string(body)
+	default:
+		return nil, false, newRequestError(http.StatusUnsupportedMediaType, "Unsupported Content-Type "+mediaType+": use application/json or application/graphql")
+	}
+
+	if !hasQuery(req) {
+		return nil, false, newRequestError(http.StatusBadRequest, "Missing query in request body")
+	}
+	return []GraphQLRequest{req}, false, nil
+}
+
+// hasQuery reports whether req carries a query, or the hash of a persisted one
+func hasQuery(req GraphQLRequest) bool {
+	return strings.TrimSpace(req.Query) != "" || req.Extensions.PersistedQuery != nil
+}
+
+// jsonEnvelope mirrors GraphQLRequest but defers decoding of variables
+type jsonEnvelope struct {
+	Query         string            `json:"query"`
+	Variables     json.RawMessage   `json:"variables"`
+	OperationName string            `json:"operationName"`
+	Extensions    RequestExtensions `json:"extensions"`
+}
+
+// decodeEnvelope parses a JSON request body into req
+func decodeEnvelope(body []byte, req *GraphQLRequest) error {
+	var envelope jsonEnvelope
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&envelope); err != nil {
+		return newRequestError(http.StatusBadRequest, "Request body is not a valid JSON object: "+err.Error())
+	}
+	if decoder.More() {
+		return newRequestError(http.StatusBadRequest, "Request body must contain a single JSON object")
+	}
+	return envelope.decode(req)
+}
+
+// decodeBatch parses a JSON request body holding an array of envelopes
+func decodeBatch(body []byte) ([]GraphQLRequest, error) {
+	var envelopes []jsonEnvelope
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&envelopes); err != nil {
+		return nil, newRequestError(http.StatusBadRequest, "Request body is not a valid JSON array of objects: "+err.Error())
+	}
+	if decoder.More() {
+		return nil, newRequestError(http.StatusBadRequest, "Request body must contain a single JSON array")
+	}
+	if len(envelopes) == 0 {
+		return nil, newRequestError(http.StatusBadRequest, "A batch must hold at least one operation")
+	}
+	requests := make([]GraphQLRequest, len(envelopes))
+	for i, envelope := range envelopes {
+		if err := envelope.decode(&requests[i]); err != nil {
+			return nil, err
+		}
+		if !hasQuery(requests[i]) {
+			return nil, newRequestError(http.StatusBadRequest, fmt.Sprintf("Missing query in operation %d of the batch", i))
+		}
+	}
+	return requests, nil
+}
+
+// decode copies the envelope into req, decoding its variables
+func (envelope jsonEnvelope) decode(req *GraphQLRequest) error {
+	req.Query = envelope.Query
+	req.OperationName = envelope.OperationName
+	req.Extensions = envelope.Extensions
+	variables, err := decodeVariables(envelope.Variables)
+	if err != nil {
+		return err
+	}
+	req.Variables = variables
+	return nil
+}
+
+// decodeVariables parses a variables object, which some clients send as a JSON encoded string
+func decodeVariables(raw []byte) (map[string]interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return nil, newRequestError(http.StatusBadRequest, "Variables must be a JSON object: "+err.Error())
+		}
+		return decodeVariables([]byte(encoded))
+	}
+	var variables map[string]interface{}
+	if err := json.Unmarshal(raw, &variables); err != nil {
+		return nil, newRequestError(http.StatusBadRequest, "Variables must be a JSON object: "+err.Error())
+	}
+	return variables, nil
+}
@@ -4,8 +4,9 @@ import "time"
 
 // User fields declared
 type User struct {
-	ID   string `json:"id" datastore:"-"`
-	Name string `json:"name"`
+	ID        string    `json:"id" datastore:"-"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // Post fields declared
@@ -13,5 +14,6 @@ type Post struct {
 	ID        string    `json:"id" datastore:"-"`
 	UserID    string    `json:"userId"`
 	CreatedAt time.Time `json:"createdAt"`
-	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Content   string    `json:"content" datastore:",noindex"` // unindexed, so it is not limited to 1500 bytes
 }
@@ -0,0 +1,55 @@
+package aepersisted
+
+import (
+	"context"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/memcache"
+)
+
+// entity is a persisted query as stored in the datastore
+type entity struct {
+	Query string `datastore:",noindex"`
+}
+
+// Store implements persisted.Store with memcache in front of the App Engine
+// datastore, which keeps the queries memcache evicts
+type Store struct {
+	kind string // datastore kind of the queries, keyed by their hash
+}
+
+// New function returns a Store keeping its queries under the datastore kind given
+func New(kind string) *Store {
+	return &Store{kind: kind}
+}
+
+// cacheKey returns the memcache key of a hash
+func (s *Store) cacheKey(hash string) string {
+	return s.kind + ":" + hash
+}
+
+// Get function
+func (s *Store) Get(ctx context.Context, hash string) (string, error) {
+	if item, err := memcache.Get(ctx, s.cacheKey(hash)); err == nil {
+		return string(item.Value), nil
+	}
+	var e entity
+	if err := datastore.Get(ctx, datastore.NewKey(ctx, s.kind, hash, 0, nil), &e); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return "", persisted.ErrNotFound
+		}
+		return "", err
+	}
+	memcache.Set(ctx, &memcache.Item{Key: s.cacheKey(hash), Value: []byte(e.Query)}) // a miss reads the datastore again
+	return e.Query, nil
+}
+
+// Put function
+func (s *Store) Put(ctx context.Context, hash, query string) error {
+	if _, err := datastore.Put(ctx, datastore.NewKey(ctx, s.kind, hash, 0, nil), &entity{Query: query}); err != nil {
+		return err
+	}
+	memcache.Set(ctx, &memcache.Item{Key: s.cacheKey(hash), Value: []byte(query)})
+	return nil
+}
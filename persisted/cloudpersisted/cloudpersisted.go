@@ -0,0 +1,46 @@
+//go:build clouddatastore
+// +build clouddatastore
+
+package cloudpersisted
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+)
+
+// entity is a persisted query as stored in the datastore, the same entity as aepersisted's
+type entity struct {
+	Query string `datastore:",noindex"`
+}
+
+// Store implements persisted.Store with the standalone Cloud Datastore client,
+// so every server shares the queries
+type Store struct {
+	client *datastore.Client
+	kind   string // datastore kind of the queries, keyed by their hash
+}
+
+// New function returns a Store keeping its queries under the datastore kind given
+func New(client *datastore.Client, kind string) *Store {
+	return &Store{client: client, kind: kind}
+}
+
+// Get function
+func (s *Store) Get(ctx context.Context, hash string) (string, error) {
+	var e entity
+	if err := s.client.Get(ctx, datastore.NameKey(s.kind, hash, nil), &e); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return "", persisted.ErrNotFound
+		}
+		return "", err
+	}
+	return e.Query, nil
+}
+
+// Put function
+func (s *Store) Put(ctx context.Context, hash, query string) error {
+	_, err := s.client.Put(ctx, datastore.NameKey(s.kind, hash, nil), &entity{Query: query})
+	return err
+}
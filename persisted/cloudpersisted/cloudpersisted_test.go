@@ -0,0 +1,36 @@
+//go:build clouddatastore
+// +build clouddatastore
+
+package cloudpersisted
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted/persistedtest"
+)
+
+// TestStore runs against the emulator at DATASTORE_EMULATOR_HOST, like the tests of clouddatastore
+func TestStore(t *testing.T) {
+	host := os.Getenv("DATASTORE_EMULATOR_HOST")
+	if host == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST is not set")
+	}
+	client, err := datastore.NewClient(context.Background(), "persistedtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	persistedtest.Run(t, func(t *testing.T) persisted.Store {
+		resp, err := http.Post("http://"+host+"/reset", "text/plain", nil)
+		if err != nil {
+			t.Fatalf("resetting the emulator: %v", err)
+		}
+		resp.Body.Close()
+		return New(client, "PersistedQuery")
+	})
+}
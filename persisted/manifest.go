@@ -0,0 +1,47 @@
+package persisted
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// apolloManifestFormat is the format of the manifests generated by Apollo's persisted query tooling
+const apolloManifestFormat = "apollo-persisted-query-manifest"
+
+// apolloManifest is a manifest in the format of Apollo
+type apolloManifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Operations []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+// ParseManifest returns the queries of a manifest by their hash. Manifests are either
+// in the format of Apollo, or a JSON object mapping hashes onto queries as generated by
+// Relay and GraphQL Code Generator, and every hash must be the SHA-256 hash of its query.
+func ParseManifest(data []byte) (map[string]string, error) {
+	queries := map[string]string{}
+	var apollo apolloManifest
+	if err := json.Unmarshal(data, &apollo); err == nil && apollo.Format == apolloManifestFormat {
+		if apollo.Version != 1 {
+			return nil, fmt.Errorf("persisted: unsupported manifest version %d", apollo.Version)
+		}
+		for _, operation := range apollo.Operations {
+			queries[operation.ID] = operation.Body
+		}
+	} else if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("persisted: manifest is neither an Apollo manifest nor an object of queries by hash")
+	}
+	hashed := make(map[string]string, len(queries))
+	for hash, query := range queries {
+		if strings.ToLower(hash) != Hash(query) {
+			return nil, fmt.Errorf("persisted: %s is not the SHA-256 hash of its query", hash)
+		}
+		hashed[Hash(query)] = query
+	}
+	return hashed, nil
+}
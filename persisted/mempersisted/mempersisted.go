@@ -0,0 +1,40 @@
+package mempersisted
+
+import (
+	"context"
+	"sync"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+)
+
+// Store implements persisted.Store in process, for local development and for
+// the backends without a shared cache. Clients register their queries again
+// with every new instance.
+type Store struct {
+	mu      sync.RWMutex
+	queries map[string]string // by hash
+}
+
+// New returns an empty store
+func New() *Store {
+	return &Store{queries: map[string]string{}}
+}
+
+// Get function
+func (s *Store) Get(ctx context.Context, hash string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	query, ok := s.queries[hash]
+	if !ok {
+		return "", persisted.ErrNotFound
+	}
+	return query, nil
+}
+
+// Put function
+func (s *Store) Put(ctx context.Context, hash, query string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries[hash] = query
+	return nil
+}
@@ -0,0 +1,12 @@
+package mempersisted
+
+import (
+	"testing"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted/persistedtest"
+)
+
+func TestStore(t *testing.T) {
+	persistedtest.Run(t, func(t *testing.T) persisted.Store { return New() })
+}
@@ -0,0 +1,25 @@
+package persisted
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// Errors returned by every Store implementation
+var (
+	ErrNotFound = errors.New("persisted: query not found")
+)
+
+// Store keeps the documents of persisted queries by the SHA-256 hash of their text
+type Store interface {
+	Get(ctx context.Context, hash string) (string, error)
+	Put(ctx context.Context, hash, query string) error
+}
+
+// Hash returns the lower case hex SHA-256 hash identifying query
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
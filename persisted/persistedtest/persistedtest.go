@@ -0,0 +1,36 @@
+// Package persistedtest checks that an implementation of persisted.Store behaves
+// like the others, each store runs it from its own tests.
+package persistedtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+)
+
+// Run runs the contract against the stores returned by newStore, which must be empty
+func Run(t *testing.T, newStore func(t *testing.T) persisted.Store) {
+	ctx := context.Background()
+	s := newStore(t)
+	queries := []string{"{ users { nodes { name } } }", "query Posts { posts(first: 10) { nodes { content } } }"}
+
+	for _, query := range queries {
+		if _, err := s.Get(ctx, persisted.Hash(query)); err != persisted.ErrNotFound {
+			t.Errorf("Get of a query never put: %v, want %v", err, persisted.ErrNotFound)
+		}
+	}
+	for _, query := range queries {
+		if err := s.Put(ctx, persisted.Hash(query), query); err != nil {
+			t.Fatalf("Put(%q): %v", query, err)
+		}
+	}
+	if err := s.Put(ctx, persisted.Hash(queries[0]), queries[0]); err != nil {
+		t.Errorf("Put of a query put before: %v", err)
+	}
+	for _, query := range queries {
+		if got, err := s.Get(ctx, persisted.Hash(query)); err != nil || got != query {
+			t.Errorf("Get(%s) = %q, %v, want %q", persisted.Hash(query), got, err, query)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package sqlpersisted
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore"
+)
+
+// Store implements persisted.Store on a table of the database of the sql backend,
+// created by the migrations of sqlstore, so every server shares the queries
+type Store struct {
+	db      *sql.DB
+	dialect sqlstore.Dialect
+	table   string // holds the queries, keyed by their hash
+}
+
+// New function returns a Store keeping its queries in the table given
+func New(db *sql.DB, dialect sqlstore.Dialect, table string) *Store {
+	return &Store{db: db, dialect: dialect, table: table}
+}
+
+// Get function
+func (s *Store) Get(ctx context.Context, hash string) (string, error) {
+	var query string
+	err := s.db.QueryRowContext(ctx, s.dialect.Rebind("SELECT query FROM "+s.table+" WHERE hash = ?"), hash).Scan(&query)
+	if err == sql.ErrNoRows {
+		return "", persisted.ErrNotFound
+	}
+	return query, err
+}
+
+// Put function
+func (s *Store) Put(ctx context.Context, hash, query string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind("INSERT INTO "+s.table+" (hash, query) VALUES (?, ?) ON CONFLICT (hash) DO UPDATE SET query = excluded.query"), hash, query)
+	return err
+}
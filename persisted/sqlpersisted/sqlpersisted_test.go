@@ -0,0 +1,39 @@
+//go:build sqlite
+// +build sqlite
+
+package sqlpersisted
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted/persistedtest"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore"
+	_ "github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore/drivers" // registers sqlite3
+)
+
+func TestStore(t *testing.T) {
+	for _, table := range []string{"persisted_queries", "allowed_queries"} {
+		t.Run(table, func(t *testing.T) {
+			persistedtest.Run(t, func(t *testing.T) persisted.Store {
+				ctx := context.Background()
+				db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "graphql.db"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { db.Close() })
+				migrations, err := sqlstore.LoadMigrations(sqlstore.MigrationsDir("../../store/sqlstore/migrations", sqlstore.SQLite))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := sqlstore.Migrate(ctx, db, sqlstore.SQLite, migrations); err != nil {
+					t.Fatal(err)
+				}
+				return New(db, sqlstore.SQLite, table)
+			})
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/middleware"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/pkg/errors"
+)
+
+// persistedQueryVersion is the version of the automatic persisted queries protocol
+const persistedQueryVersion = 1
+
+// Modes of the operation allowlist, selected with QUERY_ALLOWLIST
+const (
+	allowlistOff     = ""
+	allowlistEnforce = "enforce" // operations missing from the registered manifests are rejected
+	allowlistReport  = "report"  // they run, and are logged
+)
+
+// maxManifestSize caps the size of an uploaded manifest
+const maxManifestSize = 10 << 20
+
+// maxPersistedQuerySize caps the size of the queries remembered by hash, larger ones run but are sent in full every time
+const maxPersistedQuerySize = 32 << 10
+
+var queryAllowlist string             // declare how operations missing from the registered manifests are treated
+var manifestQueries map[string]string // declare the queries of the manifest at QUERY_ALLOWLIST_MANIFEST, by hash
+
+// Errors turning down a request before its document is parsed
+var (
+	errPersistedQueryNotFound = errors.New("PersistedQueryNotFound") // the client sends the hash again along with the query
+	errOperationNotAllowed    = errors.New("Only the operations of the registered manifests can run")
+	errAllowlistUnavailable   = errors.New("The operation allowlist cannot be read")
+)
+
+// configureAllowlist reads the QUERY_ALLOWLIST mode, and the manifest at QUERY_ALLOWLIST_MANIFEST.
+// Manifests uploaded to /admin/persisted-queries are allowed along with that one.
+func configureAllowlist() error {
+	mode := os.Getenv("QUERY_ALLOWLIST")
+	switch mode {
+	case allowlistOff, allowlistEnforce, allowlistReport:
+	default:
+		return errors.Errorf("QUERY_ALLOWLIST must be %q or %q", allowlistEnforce, allowlistReport)
+	}
+	queryAllowlist = mode
+	path := os.Getenv("QUERY_ALLOWLIST_MANIFEST")
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read QUERY_ALLOWLIST_MANIFEST")
+	}
+	manifestQueries, err = persisted.ParseManifest(data)
+	return errors.Wrapf(err, "Failed to parse %s", path)
+}
+
+// registerOperations adds the queries of a manifest, by hash, to the allowlist
+func registerOperations(ctx context.Context, queries map[string]string) error {
+	for hash, query := range queries {
+		if err := dataBackend.allowlist.Put(ctx, hash, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowedQuery returns the query of the registered manifests with the given hash, ok is false when there is none
+func allowedQuery(ctx context.Context, hash string) (query string, ok bool, err error) {
+	if query, ok := manifestQueries[hash]; ok {
+		return query, true, nil
+	}
+	query, err = dataBackend.allowlist.Get(ctx, hash)
+	if err == persisted.ErrNotFound {
+		return "", false, nil
+	}
+	return query, err == nil, err
+}
+
+// admitRequest swaps the hash of a persisted query for its document, and checks the
+// operation against the allowlist, before anything parses it
+func admitRequest(ctx context.Context, request *middleware.GraphQLRequest) error {
+	if err := resolvePersistedQuery(ctx, request); err != nil {
+		return err
+	}
+	return checkAllowlist(ctx, request)
+}
+
+// resolvePersistedQuery fills in the query of a request that only carries the hash of a
+// persisted query, and persists the query of a request carrying both
+func resolvePersistedQuery(ctx context.Context, request *middleware.GraphQLRequest) error {
+	persistedQuery := request.Extensions.PersistedQuery
+	if persistedQuery == nil {
+		return nil
+	}
+	if persistedQuery.Version != persistedQueryVersion {
+		return errors.Errorf("Unsupported persisted query version %d", persistedQuery.Version)
+	}
+	hash := strings.ToLower(persistedQuery.SHA256Hash)
+
+	if request.Query == "" {
+		if query, ok, _ := allowedQuery(ctx, hash); ok { // the operations of the manifests never need registering
+			request.Query = query
+			return nil
+		}
+		query, err := dataBackend.queries.Get(ctx, hash)
+		if err != nil {
+			if err != persisted.ErrNotFound {
+				log.Printf("Failed to read persisted query %s: %v", hash, err) // the client sends the query instead
+			}
+			return errPersistedQueryNotFound
+		}
+		request.Query = query
+		return nil
+	}
+
+	if persisted.Hash(request.Query) != hash {
+		return errors.New("Provided sha does not match query")
+	}
+	if queryAllowlist == allowlistEnforce {
+		return nil // only the manifests decide what runs
+	}
+	persistQuery(ctx, hash, *request)
+	return nil
+}
+
+// persistQuery remembers the query of a request under its hash, unless it is too large or
+// fails to parse, validate or pass the limits, so that only documents that can run are stored
+func persistQuery(ctx context.Context, hash string, request middleware.GraphQLRequest) {
+	if len(request.Query) > maxPersistedQuerySize {
+		return
+	}
+	if _, _, result := parseOperation(request); result != nil {
+		return // the errors are reported as the request runs
+	}
+	if err := dataBackend.queries.Put(ctx, hash, request.Query); err != nil {
+		log.Printf("Failed to persist query %s: %v", hash, err) // the query runs anyway
+	}
+}
+
+// checkAllowlist turns down, or reports, the operations missing from the registered manifests
+func checkAllowlist(ctx context.Context, request *middleware.GraphQLRequest) error {
+	if queryAllowlist == allowlistOff {
+		return nil
+	}
+	hash := persisted.Hash(request.Query)
+	_, ok, err := allowedQuery(ctx, hash)
+	if err != nil {
+		log.Printf("Failed to read the operation allowlist: %v", err)
+		if queryAllowlist == allowlistEnforce {
+			return errAllowlistUnavailable
+		}
+		return nil
+	}
+	if ok {
+		return nil
+	}
+	if queryAllowlist == allowlistReport {
+		log.Printf("Operation %s (%q) is missing from the manifests and would be blocked", hash, request.OperationName)
+		return nil
+	}
+	return errOperationNotAllowed
+}
+
+// admissionError returns the HTTP status and error of a request admitRequest turned down
+func admissionError(err error) (int, gqlerrors.FormattedError) {
+	switch err {
+	case errPersistedQueryNotFound:
+		formatted := gqlerrors.NewFormattedError(err.Error())
+		formatted.Extensions = map[string]interface{}{"code": apperrors.PersistedQueryNotFound}
+		return http.StatusOK, formatted // clients expect it with a successful status
+	case errOperationNotAllowed:
+		return http.StatusForbidden, middleware.FormatRequestError(err.Error(), http.StatusForbidden)
+	case errAllowlistUnavailable:
+		return http.StatusInternalServerError, middleware.FormatRequestError(err.Error(), http.StatusInternalServerError)
+	}
+	return http.StatusBadRequest, middleware.FormatRequestError(err.Error(), http.StatusBadRequest)
+}
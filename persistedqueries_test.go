@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/persisted"
+)
+
+func TestAutomaticPersistedQueries(t *testing.T) {
+	server := newTestServer(t)
+	seedUser(t, "Ann")
+	const query = `{ users(first: 1) { nodes { name } } }`
+	hash := persisted.Hash(query)
+	extensions := func(version int, hash string) map[string]interface{} {
+		return map[string]interface{}{"persistedQuery": map[string]interface{}{"version": version, "sha256Hash": hash}}
+	}
+
+	// the steps run in order, against the same server
+	steps := []struct {
+		name       string
+		body       map[string]interface{}
+		wantStatus int
+		wantCode   string
+	}{
+		{"unknown hash", map[string]interface{}{"extensions": extensions(1, hash)}, http.StatusOK, "PERSISTED_QUERY_NOT_FOUND"},
+		{"hash and query", map[string]interface{}{"query": query, "extensions": extensions(1, hash)}, http.StatusOK, ""},
+		{"known hash", map[string]interface{}{"extensions": extensions(1, hash)}, http.StatusOK, ""},
+		{"upper case hash", map[string]interface{}{"extensions": extensions(1, strings.ToUpper(hash))}, http.StatusOK, ""},
+		{"hash of another query", map[string]interface{}{"query": "{ users { nodes { id } } }", "extensions": extensions(1, hash)}, http.StatusBadRequest, "BAD_REQUEST"},
+		{"unsupported version", map[string]interface{}{"extensions": extensions(2, hash)}, http.StatusBadRequest, "BAD_REQUEST"},
+	}
+	for _, step := range steps {
+		status, body := postJSON(t, server, "", step.body)
+		var resp gqlResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("%s: decoding %s: %v", step.name, body, err)
+		}
+		if status != step.wantStatus || resp.code() != step.wantCode {
+			t.Errorf("%s: status %d and code %q, want %d and %q (%s)", step.name, status, resp.code(), step.wantStatus, step.wantCode, body)
+			continue
+		}
+		if step.wantCode != "" {
+			continue
+		}
+		var data struct {
+			Users struct{ Nodes []struct{ Name string } }
+		}
+		resp.decode(t, &data)
+		if len(data.Users.Nodes) != 1 || data.Users.Nodes[0].Name != "Ann" {
+			t.Errorf("%s: data = %s, want the users", step.name, resp.Data)
+		}
+	}
+
+	t.Run("invalid queries are not persisted", func(t *testing.T) {
+		for _, query := range []string{
+			"this is not graphql at all",
+			"{ unknownField }",
+			"{ users { nodes { name } } }" + strings.Repeat(" ", maxPersistedQuerySize),
+		} {
+			hash := persisted.Hash(query)
+			postJSON(t, server, "", map[string]interface{}{"query": query, "extensions": extensions(1, hash)})
+			if stored, err := dataBackend.queries.Get(context.Background(), hash); err != persisted.ErrNotFound {
+				t.Errorf("query %.30q was stored as %.30q (%v), want it left out", query, stored, err)
+			}
+		}
+	})
+
+	t.Run("GET", func(t *testing.T) { // CDNs cache the queries sent by hash over GET
+		raw, _ := json.Marshal(extensions(1, hash))
+		resp, err := http.Get(server.URL + "/graphql?" + url.Values{"extensions": {string(raw)}}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || !containsName(body, "Ann") {
+			t.Errorf("GET by hash = %d %s, want the users", resp.StatusCode, body)
+		}
+	})
+}
+
+// logBuffer collects what the handlers log, as they log from the goroutines of the server
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// uploadManifest posts manifest to /admin/persisted-queries, and returns the status and body of the response
+func uploadManifest(t *testing.T, server *httptest.Server, token string, manifest interface{}) (int, []byte) {
+	t.Helper()
+	payload, _ := json.Marshal(manifest)
+	r, err := http.NewRequest(http.MethodPost, server.URL+"/admin/persisted-queries", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body
+}
+
+func TestOperationAllowlist(t *testing.T) {
+	mode, logs := queryAllowlist, &logBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { // once the server has closed, and its handlers have returned
+		queryAllowlist = mode
+		log.SetOutput(os.Stderr)
+	})
+	server := newTestServer(t)
+	seedUser(t, "Ann")
+	const allowed = `{ users(first: 1) { nodes { name } } }`
+	const unlisted = `{ users(first: 2) { nodes { name } } }`
+	manifest := map[string]string{persisted.Hash(allowed): allowed}
+
+	if status, body := uploadManifest(t, server, tokenFor(auth.Viewer{UserID: "someone"}), manifest); status != http.StatusForbidden {
+		t.Errorf("upload by a user = %d %s, want 403", status, body)
+	}
+	if status, body := uploadManifest(t, server, tokenFor(auth.Viewer{Admin: true}), manifest); status != http.StatusOK || !bytes.Contains(body, []byte(`"registered":1`)) {
+		t.Fatalf("upload by an admin = %d %s, want one operation registered", status, body)
+	}
+	if query, err := dataBackend.allowlist.Get(context.Background(), persisted.Hash(allowed)); err != nil || query != allowed {
+		t.Fatalf("registered query = %q, %v, want %q", query, err, allowed)
+	}
+
+	for _, test := range []struct {
+		name, mode, query string
+		wantStatus        int
+		wantLogged        bool
+	}{
+		{"enforced, registered", allowlistEnforce, allowed, http.StatusOK, false},
+		{"enforced, missing", allowlistEnforce, unlisted, http.StatusForbidden, false},
+		{"reported, registered", allowlistReport, allowed, http.StatusOK, false},
+		{"reported, missing", allowlistReport, unlisted, http.StatusOK, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			queryAllowlist = test.mode
+			before := len(logs.String())
+			status, body := postJSON(t, server, "", map[string]interface{}{"query": test.query})
+			if status != test.wantStatus {
+				t.Errorf("status = %d (%s), want %d", status, body, test.wantStatus)
+			}
+			if test.wantStatus == http.StatusOK && !containsName(body, "Ann") {
+				t.Errorf("body = %s, want the users", body)
+			}
+			logged := strings.Contains(logs.String()[before:], persisted.Hash(test.query))
+			if logged != test.wantLogged {
+				t.Errorf("logged = %v (%s), want %v", logged, logs.String()[before:], test.wantLogged)
+			}
+		})
+	}
+
+	t.Run("by hash", func(t *testing.T) { // the registered operations never need persisting
+		queryAllowlist = allowlistEnforce
+		extensions := map[string]interface{}{"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": persisted.Hash(allowed)}}
+		if status, body := postJSON(t, server, "", map[string]interface{}{"extensions": extensions}); status != http.StatusOK || !containsName(body, "Ann") {
+			t.Errorf("query by hash = %d %s, want the users", status, body)
+		}
+	})
+}
+
+// containsName reports whether the users of a response body include name
+func containsName(body []byte, name string) bool {
+	var resp struct {
+		Data struct {
+			Users struct{ Nodes []struct{ Name string } }
+		}
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return false
+	}
+	for _, node := range resp.Data.Users.Nodes {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package pubsub
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+)
+
+// Topics of the events published on post changes, named after the subscription fields
+const (
+	PostCreated = "postCreated"
+	PostUpdated = "postUpdated"
+	PostDeleted = "postDeleted"
+)
+
+// Event is a change published to the subscribers of its topic
+type Event struct {
+	ID    string `json:"id"` // assigned by the broker, subscribers resume after it
+	Topic string `json:"topic"`
+	Post  m.Post `json:"post"`
+}
+
+// Broker delivers published events to the subscribers of their topic. Local only
+// reaches the subscribers of the same process, deployments running several
+// instances plug in a broker backed by a shared bus.
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+	// Subscribe returns the events published on topic until ctx is done, the channel
+	// is closed then, or earlier when the subscriber falls too far behind. When after
+	// is the ID of a past event, the events that followed it are delivered first, as
+	// far as the broker still holds them.
+	Subscribe(ctx context.Context, topic, after string) (<-chan Event, error)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying b
+func NewContext(ctx context.Context, b Broker) context.Context {
+	return context.WithValue(ctx, contextKey{}, b)
+}
+
+// FromContext returns the Broker carried by ctx
+func FromContext(ctx context.Context) Broker {
+	b, ok := ctx.Value(contextKey{}).(Broker)
+	if !ok {
+		panic("pubsub: no Broker in context")
+	}
+	return b
+}
+
+const (
+	bufferSize  = 64  // number of events a subscriber may fall behind before it is dropped
+	historySize = 100 // number of past events of a topic kept for the subscribers resuming after one
+)
+
+// Local delivers events to the subscribers of the current process. Its event IDs
+// are sequence numbers starting from the time it was created, so they keep
+// growing across restarts.
+type Local struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     map[string][]Event             // by topic, oldest first
+	subscribers map[string]map[chan Event]bool // by topic
+}
+
+// NewLocal function
+func NewLocal() *Local {
+	return &Local{
+		lastID:      uint64(time.Now().UnixNano()),
+		history:     map[string][]Event{},
+		subscribers: map[string]map[chan Event]bool{},
+	}
+}
+
+// Publish function never blocks, a subscriber whose buffer is full is dropped
+func (b *Local) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	event.ID = strconv.FormatUint(b.lastID, 10)
+	history := append(b.history[event.Topic], event)
+	if len(history) > historySize {
+		history = history[len(history)-historySize:]
+	}
+	b.history[event.Topic] = history
+	for events := range b.subscribers[event.Topic] {
+		select {
+		case events <- event:
+		default:
+			b.remove(event.Topic, events)
+		}
+	}
+	return nil
+}
+
+// Subscribe function
+func (b *Local) Subscribe(ctx context.Context, topic, after string) (<-chan Event, error) {
+	b.mu.Lock()
+	var missed []Event
+	if afterID, err := strconv.ParseUint(after, 10, 64); err == nil {
+		for _, event := range b.history[topic] {
+			if id, _ := strconv.ParseUint(event.ID, 10, 64); id > afterID {
+				missed = append(missed, event)
+			}
+		}
+	}
+	events := make(chan Event, bufferSize+len(missed))
+	for _, event := range missed {
+		events <- event
+	}
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = map[chan Event]bool{}
+	}
+	b.subscribers[topic][events] = true
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(topic, events)
+	}()
+	return events, nil
+}
+
+// remove closes the channel of a subscriber unless it is gone already, b.mu must be held
+func (b *Local) remove(topic string, events chan Event) {
+	if !b.subscribers[topic][events] {
+		return
+	}
+	delete(b.subscribers[topic], events)
+	close(events)
+}
+
+// Discard drops every event, for contexts that cannot reach the subscribers
+type Discard struct{}
+
+// Publish function
+func (Discard) Publish(ctx context.Context, event Event) error {
+	return nil
+}
+
+// Subscribe function returns a channel closed along with ctx
+func (Discard) Subscribe(ctx context.Context, topic, after string) (<-chan Event, error) {
+	events := make(chan Event)
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+	return events, nil
+}
@@ -0,0 +1,54 @@
+package resolvers
+
+import (
+	"context"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+)
+
+// deleteUserPostsTask removes the posts left behind by a deleted user
+const deleteUserPostsTask = "deleteUserPosts"
+
+func init() {
+	tasks.Register(deleteUserPostsTask, func(ctx context.Context, userID string) error {
+		_, err := deleteUserPosts(ctx, userID, -1)
+		return err
+	})
+}
+
+// deleteUserPosts deletes the posts of a user in batches, stopping after the
+// given number of batches unless it is negative, and reports whether posts remain
+func deleteUserPosts(ctx context.Context, userID string, batches int) (bool, error) {
+	s := store.FromContext(ctx)
+	query := store.PostQuery{UserID: userID, Limit: store.MaxBatchSize}
+	for batch := 0; batches < 0 || batch < batches; batch++ {
+		page, err := s.ListPosts(ctx, query)
+		if err != nil {
+			return true, err
+		}
+		ids := make([]string, len(page.Posts))
+		for i, post := range page.Posts {
+			ids[i] = post.ID
+		}
+		if len(ids) > 0 {
+			// unindex first, the posts cannot be found again once they are deleted
+			if err := search.FromContext(ctx).DeletePosts(ctx, ids); err != nil {
+				return true, err
+			}
+			if err := s.DeletePosts(ctx, ids); err != nil {
+				return true, err
+			}
+			for _, post := range page.Posts {
+				publishPost(ctx, pubsub.PostDeleted, post)
+			}
+		}
+		if !page.More {
+			return false, nil
+		}
+		query.Start = page.End // the datastore may keep returning deleted posts for a while
+	}
+	return true, nil
+}
@@ -0,0 +1,57 @@
+package resolvers
+
+import (
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/graphql-go/graphql"
+)
+
+// UserError is a problem with the input of a mutation the client can correct
+type UserError struct {
+	Field   []string `json:"field"` // path to the input field, when the error is about one
+	Message string   `json:"message"`
+}
+
+// MutationPayload is the result of every mutation, only the entity of the mutation is exposed
+type MutationPayload struct {
+	ClientMutationID interface{} `json:"clientMutationId"`
+	UserErrors       []UserError `json:"userErrors"`
+	User             *m.User     `json:"user"`
+	Post             *m.Post     `json:"post"`
+	Token            *string     `json:"token"` // of the user createUser created
+}
+
+// createdUser is the result of createUser, the user along with a token acting as them
+type createdUser struct {
+	user  *m.User
+	token *string
+}
+
+// Mutation function adapts a resolver to mutations taking a single `input`
+// argument: the fields of the input become the arguments of resolve, and
+// errors about an argument are returned as user errors of the payload
+func Mutation(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		input, _ := params.Args["input"].(map[string]interface{})
+		params.Args = input
+		payload := &MutationPayload{ClientMutationID: input["clientMutationId"], UserErrors: []UserError{}}
+
+		value, err := resolve(params)
+		if appErr, ok := err.(*apperrors.Error); ok && appErr.Field != "" {
+			payload.UserErrors = append(payload.UserErrors, UserError{Field: []string{"input", appErr.Field}, Message: appErr.Message})
+			return payload, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch entity := value.(type) {
+		case *m.User:
+			payload.User = entity
+		case *m.Post:
+			payload.Post = entity
+		case createdUser:
+			payload.User, payload.Token = entity.user, entity.token
+		}
+		return payload, nil
+	}
+}
@@ -0,0 +1,174 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/loaders"
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/graphql-go/graphql"
+)
+
+// Types of node, they prefix the global IDs
+const (
+	UserNode = "User"
+	PostNode = "Post"
+)
+
+// GlobalID function returns the opaque ID of the node of the given type and store ID
+func GlobalID(nodeType, id string) string {
+	if id == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(nodeType + ":" + id))
+}
+
+// NodeRef struct is a decoded global ID
+type NodeRef struct {
+	Type string
+	ID   string // store ID
+}
+
+// isStoreID reports whether id has the form of the IDs handed out by the stores
+func isStoreID(id string) bool {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	return err == nil && intID > 0
+}
+
+// ParseGlobalID function returns the type and store ID of a global ID, ok is false for anything else
+func ParseGlobalID(globalID string) (nodeType, id string, ok bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(globalID)
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || !isStoreID(parts[1]) || (parts[0] != UserNode && parts[0] != PostNode) {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// DecodeID function returns the store ID of a global ID of type nodeType, or nil when value is none.
+// The legacy store IDs handed out before global IDs are still accepted as they are.
+func DecodeID(nodeType, value string) interface{} {
+	if isStoreID(value) {
+		return value
+	}
+	idType, id, ok := ParseGlobalID(value)
+	if !ok || idType != nodeType {
+		return nil
+	}
+	return id
+}
+
+// DecodeNodeID function returns the NodeRef of a global ID, or nil when value is none
+func DecodeNodeID(value string) interface{} {
+	nodeType, id, ok := ParseGlobalID(value)
+	if !ok {
+		return nil
+	}
+	return NodeRef{Type: nodeType, ID: id}
+}
+
+// nodeID returns the store ID of a User or Post source
+func nodeID(source interface{}) string {
+	switch node := source.(type) {
+	case *m.User:
+		return node.ID
+	case m.User:
+		return node.ID
+	case *m.Post:
+		return node.ID
+	case m.Post:
+		return node.ID
+	}
+	return ""
+}
+
+// ResolveUserID function
+func ResolveUserID(params graphql.ResolveParams) (interface{}, error) {
+	return GlobalID(UserNode, nodeID(params.Source)), nil
+}
+
+// ResolvePostID function
+func ResolvePostID(params graphql.ResolveParams) (interface{}, error) {
+	return GlobalID(PostNode, nodeID(params.Source)), nil
+}
+
+// ResolvePostUserID function returns the global ID of the author of a post
+func ResolvePostUserID(params graphql.ResolveParams) (interface{}, error) {
+	switch post := params.Source.(type) {
+	case *m.Post:
+		return GlobalID(UserNode, post.UserID), nil
+	case m.Post:
+		return GlobalID(UserNode, post.UserID), nil
+	}
+	return nil, nil
+}
+
+// NodeType function returns the name of the object type of a node
+func NodeType(source interface{}) string {
+	switch source.(type) {
+	case *m.User, m.User:
+		return UserNode
+	case *m.Post, m.Post:
+		return PostNode
+	}
+	return ""
+}
+
+// loadNode returns a thunk yielding the node ref points to, or nil when there is none
+func loadNode(ctx context.Context, ref NodeRef) func() (interface{}, error) {
+	var thunk func() (interface{}, error)
+	switch ref.Type {
+	case UserNode:
+		user := loaders.FromContext(ctx).User(ctx, ref.ID)
+		thunk = func() (interface{}, error) { return user() }
+	case PostNode:
+		post := loaders.FromContext(ctx).Post(ctx, ref.ID)
+		thunk = func() (interface{}, error) { return post() }
+	default:
+		return func() (interface{}, error) { return nil, nil }
+	}
+	return func() (interface{}, error) {
+		node, err := thunk()
+		if err == store.ErrNotFound || err == store.ErrInvalidID { // unknown nodes are null
+			return nil, nil
+		}
+		if err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		return node, nil
+	}
+}
+
+// QueryNode function
+func QueryNode(params graphql.ResolveParams) (interface{}, error) {
+	ref, _ := params.Args["id"].(NodeRef)
+	return loadNode(params.Context, ref), nil
+}
+
+// QueryNodes function returns the nodes in the order of the ids, fetched with a single batch per type
+func QueryNodes(params graphql.ResolveParams) (interface{}, error) {
+	ids, _ := params.Args["ids"].([]interface{})
+	thunks := make([]func() (interface{}, error), len(ids))
+	for i, id := range ids {
+		ref, _ := id.(NodeRef)
+		thunks[i] = loadNode(params.Context, ref)
+	}
+	return func() (interface{}, error) {
+		nodes := make([]interface{}, len(thunks))
+		for i, thunk := range thunks {
+			node, err := thunk()
+			if err != nil {
+				return nil, err
+			}
+			nodes[i] = node
+		}
+		return nodes, nil
+	}, nil
+}
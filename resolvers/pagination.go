@@ -0,0 +1,174 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/graphql-go/graphql"
+)
+
+// PageInfo struct
+type PageInfo struct {
+	HasNextPage     bool   `json:"hasNextPage"`
+	HasPreviousPage bool   `json:"hasPreviousPage"`
+	StartCursor     string `json:"startCursor"`
+	EndCursor       string `json:"endCursor"`
+}
+
+// totalCounter is implemented by list results that can count every matching node
+type totalCounter interface {
+	totalCount(ctx context.Context) func() (interface{}, error)
+}
+
+// ResolveTotalCount function only counts when `totalCount` is selected
+func ResolveTotalCount(params graphql.ResolveParams) (interface{}, error) {
+	counter, ok := params.Source.(totalCounter)
+	if !ok {
+		return nil, nil
+	}
+	return counter.totalCount(params.Context), nil
+}
+
+// Bounds of the `first`, `last` and `limit` arguments of the lists
+const (
+	DefaultPageSize = 100 // number of nodes a list returns without first, last or limit
+	maxPageSize     = 100
+)
+
+// pageArgs holds the pagination arguments of a list field
+type pageArgs struct {
+	First  int // number of nodes to return
+	Offset int
+	After  *cursor
+	Before *cursor
+	Last   bool // page backwards from Before, or from the end of the list
+}
+
+// cursor is the decoded form of the opaque cursor handed to clients.
+// Position is a datastore cursor and is only valid for a query running in the
+// same direction it was produced in, so the sort key of the node (its Name,
+// CreatedAt or UpdatedAt) is kept to seek a query running the other way, along
+// with the ID of a post to tell apart the posts sharing their sort key.
+type cursor struct {
+	Position  string    `json:"p"`
+	Reverse   bool      `json:"r,omitempty"`
+	Order     string    `json:"o,omitempty"` // ordering of the list the cursor belongs to
+	Name      string    `json:"n,omitempty"`
+	CreatedAt time.Time `json:"t"` // or UpdatedAt, for posts ordered by it
+	ID        string    `json:"i,omitempty"`
+}
+
+// encodeCursor function
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor function
+func decodeCursor(argName, s string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, apperrors.InvalidArgumentf("Invalid cursor for %s", argName)
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, apperrors.InvalidArgumentf("Invalid cursor for %s", argName)
+	}
+	return c, nil
+}
+
+// parsePageArgs reads `first/after/last/before` and the legacy `limit/offset` arguments
+func parsePageArgs(args map[string]interface{}) (pageArgs, error) {
+	page := pageArgs{First: DefaultPageSize}
+
+	first, hasFirst := args["first"].(int)
+	last, hasLast := args["last"].(int)
+	limit, hasLimit := args["limit"].(int)
+	offset, hasOffset := args["offset"].(int)
+
+	switch {
+	case hasFirst && hasLast:
+		return page, apperrors.InvalidArgumentf("first and last cannot be combined")
+	case (hasFirst || hasLast) && (hasLimit || hasOffset):
+		return page, apperrors.InvalidArgumentf("limit and offset cannot be combined with first or last")
+	case hasFirst && first < 0, hasLast && last < 0, hasLimit && limit < 0, hasOffset && offset < 0:
+		return page, apperrors.InvalidArgumentf("Pagination arguments must not be negative")
+	case first > maxPageSize, last > maxPageSize, limit > maxPageSize:
+		return page, apperrors.InvalidArgumentf("first, last and limit must be at most %d", maxPageSize)
+	}
+
+	if after, ok := args["after"].(string); ok && after != "" {
+		c, err := decodeCursor("after", after)
+		if err != nil {
+			return page, err
+		}
+		page.After = c
+	}
+	if before, ok := args["before"].(string); ok && before != "" {
+		c, err := decodeCursor("before", before)
+		if err != nil {
+			return page, err
+		}
+		page.Before = c
+	}
+
+	switch {
+	case hasFirst:
+		page.First = first
+	case hasLast:
+		page.First = last
+		page.Last = true
+	case hasLimit:
+		page.First = limit
+	}
+	if page.Before != nil && !hasFirst {
+		page.Last = true // `before` on its own pages backwards
+	}
+	page.Offset = offset
+	return page, nil
+}
+
+// checkOrder rejects cursors taken from a list with another ordering
+func (page pageArgs) checkOrder(order string) error {
+	if page.After != nil && page.After.Order != order {
+		return apperrors.InvalidArgumentf("Invalid cursor for after, the list was ordered differently")
+	}
+	if page.Before != nil && page.Before.Order != order {
+		return apperrors.InvalidArgumentf("Invalid cursor for before, the list was ordered differently")
+	}
+	return nil
+}
+
+// resume returns the cursor whose store position can resume the query. A store
+// cursor can only resume a query running in the direction it came from, any
+// other bound has to be applied as a filter on the sort key.
+func (page pageArgs) resume() *cursor {
+	c := page.After
+	if page.Last {
+		c = page.Before
+	}
+	if c == nil || c.Position == "" || c.Reverse != page.Last || (page.After != nil && page.Before != nil) {
+		return nil
+	}
+	return c
+}
+
+// info returns the page info of a page of nodes, more tells whether the store has nodes past it
+func (page pageArgs) info(more bool, cursors []string) PageInfo {
+	var info PageInfo
+	if page.Last {
+		info.HasPreviousPage = more
+		info.HasNextPage = page.Before != nil
+	} else {
+		info.HasNextPage = more
+		info.HasPreviousPage = page.After != nil || page.Offset > 0
+	}
+	if n := len(cursors); n > 0 {
+		info.StartCursor = cursors[0]
+		info.EndCursor = cursors[n-1]
+	}
+	return info
+}
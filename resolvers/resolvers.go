@@ -2,67 +2,455 @@ package resolvers
 
 import (
 	"context"
-	"errors"
+	"log"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/loaders"
 	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/validate"
 	"github.com/graphql-go/graphql"
-	"google.golang.org/appengine/datastore"
 )
 
+// PostEdge struct
+type PostEdge struct {
+	Cursor string `json:"cursor"`
+	Node   m.Post `json:"node"`
+}
+
+// UserEdge struct
+type UserEdge struct {
+	Cursor string `json:"cursor"`
+	Node   m.User `json:"node"`
+}
+
+// UserListResult struct
+type UserListResult struct {
+	Nodes    []m.User   `json:"nodes"`
+	Edges    []UserEdge `json:"edges"`
+	PageInfo PageInfo   `json:"pageInfo"`
+
+	countQuery store.UserQuery // every matching user, regardless of the page
+}
+
+// totalCount counts the users matching the list's filters
+func (result UserListResult) totalCount(ctx context.Context) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		count, err := store.FromContext(ctx).CountUsers(ctx, result.countQuery)
+		if err != nil {
+			return nil, storeError(err, "User")
+		}
+		return count, nil
+	}
+}
+
 // PostListResult struct
 type PostListResult struct {
-	Nodes      []m.Post `json:"nodes"`
-	TotalCount int      `json:"totalCount"`
+	Nodes    []m.Post   `json:"nodes"`
+	Edges    []PostEdge `json:"edges"`
+	PageInfo PageInfo   `json:"pageInfo"`
+
+	countQueries []store.PostQuery // every matching post regardless of the page, one query per author when there are several
+}
+
+// totalCount counts the posts matching the list's filters
+func (result PostListResult) totalCount(ctx context.Context) func() (interface{}, error) {
+	thunks := make([]func() (int, error), len(result.countQueries))
+	for i, query := range result.countQueries {
+		thunks[i] = loaders.FromContext(ctx).PostCount(ctx, query)
+	}
+	return func() (interface{}, error) {
+		total := 0
+		for _, thunk := range thunks {
+			count, err := thunk()
+			if err != nil {
+				return nil, storeError(err, "Post")
+			}
+			total += count
+		}
+		return total, nil
+	}
+}
+
+// storeError maps store errors onto typed errors for the client
+func storeError(err error, kind string) error {
+	switch err {
+	case store.ErrNotFound:
+		return apperrors.NotFoundf("%s not found", kind)
+	case store.ErrInvalidID:
+		return apperrors.InvalidArgumentf("Invalid %s id", kind)
+	case store.ErrInvalidQuery:
+		return apperrors.InvalidArgumentf("Invalid cursor")
+	case store.ErrNeedIndex:
+		return apperrors.InvalidArgumentf("This combination of %s filters and ordering is not supported", kind)
+	default:
+		return apperrors.InternalError(err)
+	}
+}
+
+// maxPostUserIDs is the largest number of authors the posts list accepts in `userIDs`,
+// the datastore has no IN filter so every author is queried on its own
+const maxPostUserIDs = 30
+
+// postOrder reads the `orderBy` argument of the posts lists, newest first by default
+func postOrder(args map[string]interface{}) (field store.PostOrder, descending bool, name string) {
+	orderBy, _ := args["orderBy"].(map[string]interface{})
+	fieldName, _ := orderBy["field"].(string)
+	direction, _ := orderBy["direction"].(string)
+	if fieldName == "" {
+		fieldName = "CREATED_AT"
+	}
+	if direction == "" {
+		direction = "DESC"
+	}
+	if fieldName == "UPDATED_AT" {
+		field = store.PostOrderUpdatedAt
+	}
+	name = fieldName + "_" + direction
+	if name == "CREATED_AT_DESC" {
+		name = "" // the order of the cursors handed out before posts could be ordered
+	}
+	return field, direction == "DESC", name
+}
+
+// postUserIDs reads the `userIDs` argument, filtered is false when it is absent
+func postUserIDs(args map[string]interface{}) (userIDs []string, filtered bool, err error) {
+	values, filtered := args["userIDs"].([]interface{})
+	seen := map[string]bool{}
+	for _, value := range values {
+		if id, ok := value.(string); ok && !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) > maxPostUserIDs {
+		return nil, true, apperrors.InvalidArgumentf("userIDs accepts at most %d ids", maxPostUserIDs).OnField("userIDs")
+	}
+	return userIDs, filtered, nil
+}
+
+// queryPostList returns a thunk yielding the page of posts selected by args
+func queryPostList(ctx context.Context, query store.PostQuery, args map[string]interface{}) (interface{}, error) {
+	var descending bool
+	var order string
+	query.OrderBy, descending, order = postOrder(args)
+	query.CreatedAfter, _ = args["createdAfter"].(time.Time)
+	query.CreatedBefore, _ = args["createdBefore"].(time.Time)
+	if query.OrderBy != store.PostOrderCreatedAt && !(query.CreatedAfter.IsZero() && query.CreatedBefore.IsZero()) {
+		// the datastore only filters ranges of the property it orders by
+		return nil, apperrors.InvalidArgumentf("createdAfter and createdBefore can only be combined with ordering by CREATED_AT")
+	}
+	userIDs, filtered, err := postUserIDs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := parsePageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := page.checkOrder(order); err != nil {
+		return nil, err
+	}
+
+	// one query per author, merged afterwards
+	queries := []store.PostQuery{query}
+	if filtered {
+		queries = make([]store.PostQuery, len(userIDs))
+		for i, userID := range userIDs {
+			queries[i] = query
+			queries[i].UserID = userID
+		}
+	}
+	result := PostListResult{countQueries: queries}
+	if len(queries) == 0 {
+		return buildPostList(result, page, order, query.OrderBy, store.PostPage{}), nil
+	}
+
+	// bounds that cannot resume the query are applied as filters on the sort key and ID,
+	// `after` bounds the list from below when it is ascending and from above when descending
+	resume := page.resume()
+	if resume != nil {
+		query.Start = resume.Position
+	}
+	for _, bound := range []struct {
+		cursor *cursor
+		above  bool // whether the list continues above the sort key of cursor
+	}{{page.After, !descending}, {page.Before, descending}} {
+		if bound.cursor == nil || bound.cursor == resume {
+			continue
+		}
+		position := &store.PostPosition{SortKey: bound.cursor.CreatedAt, ID: bound.cursor.ID}
+		switch {
+		case position.ID != "" && bound.above:
+			query.After = position
+		case position.ID != "":
+			query.Before = position
+		case query.OrderBy == store.PostOrderUpdatedAt && bound.above: // cursors handed out before they held the ID
+			query.UpdatedAfter = bound.cursor.CreatedAt
+		case query.OrderBy == store.PostOrderUpdatedAt:
+			query.UpdatedBefore = bound.cursor.CreatedAt
+		case bound.above && bound.cursor.CreatedAt.After(query.CreatedAfter):
+			query.CreatedAfter = bound.cursor.CreatedAt
+		case !bound.above && (query.CreatedBefore.IsZero() || bound.cursor.CreatedAt.Before(query.CreatedBefore)):
+			query.CreatedBefore = bound.cursor.CreatedAt
+		}
+	}
+	query.Descending = descending != page.Last // walk backwards and reverse the page afterwards
+	query.Offset = page.Offset
+	query.Limit = page.First
+
+	// run the queries along with the other pages of this level
+	thunks := make([]func() (store.PostPage, error), len(queries))
+	for i, userQuery := range queries {
+		pageQuery := query
+		pageQuery.UserID = userQuery.UserID
+		if len(queries) > 1 { // every author may hold the whole page, the merged page cannot resume
+			pageQuery.Start, pageQuery.Offset = "", 0
+			pageQuery.Limit += query.Offset
+		}
+		thunks[i] = loaders.FromContext(ctx).PostPage(ctx, pageQuery)
+	}
+	return func() (interface{}, error) {
+		pages := make([]store.PostPage, len(thunks))
+		for i, thunk := range thunks {
+			posts, err := thunk()
+			if err != nil {
+				return nil, storeError(err, "Post")
+			}
+			pages[i] = posts
+		}
+		posts := pages[0]
+		if len(pages) > 1 {
+			posts = mergePostPages(query, pages)
+		}
+		return buildPostList(result, page, order, query.OrderBy, posts), nil
+	}, nil
+}
+
+// postSortKey returns the value of the property posts are ordered by
+func postSortKey(post m.Post, order store.PostOrder) time.Time {
+	if order == store.PostOrderUpdatedAt {
+		return post.UpdatedAt
+	}
+	return post.CreatedAt
+}
+
+// mergePostPages merges the pages of the authors of query, ordered as the
+// stores order them, and cuts out the page query asks for
+func mergePostPages(query store.PostQuery, pages []store.PostPage) store.PostPage {
+	var merged store.PostPage
+	for _, posts := range pages {
+		merged.Posts = append(merged.Posts, posts.Posts...)
+		merged.More = merged.More || posts.More
+	}
+	sort.Slice(merged.Posts, func(i, j int) bool {
+		a, b := merged.Posts[i], merged.Posts[j]
+		if query.Descending {
+			a, b = b, a
+		}
+		aKey, bKey := postSortKey(a, query.OrderBy), postSortKey(b, query.OrderBy)
+		if !aKey.Equal(bKey) {
+			return aKey.Before(bKey)
+		}
+		aID, _ := strconv.ParseInt(a.ID, 10, 64)
+		bID, _ := strconv.ParseInt(b.ID, 10, 64)
+		return aID < bID
+	})
+
+	offset := query.Offset
+	if offset > len(merged.Posts) {
+		offset = len(merged.Posts)
+	}
+	merged.Posts = merged.Posts[offset:]
+	if len(merged.Posts) > query.Limit {
+		merged.Posts, merged.More = merged.Posts[:query.Limit], true
+	}
+	return merged
+}
+
+// buildPostList turns a page of posts into edges and page info
+func buildPostList(result PostListResult, page pageArgs, order string, orderBy store.PostOrder, posts store.PostPage) PostListResult {
+	result.Nodes = posts.Posts
+
+	result.Edges = make([]PostEdge, len(result.Nodes))
+	for i, post := range result.Nodes {
+		c := cursor{Reverse: page.Last, Order: order, CreatedAt: postSortKey(post, orderBy), ID: post.ID}
+		if i == len(result.Nodes)-1 {
+			c.Position = posts.End
+		}
+		result.Edges[i] = PostEdge{Node: post, Cursor: encodeCursor(c)}
+	}
+
+	if page.Last { // restore the requested order
+		for i, j := 0, len(result.Nodes)-1; i < j; i, j = i+1, j-1 {
+			result.Nodes[i], result.Nodes[j] = result.Nodes[j], result.Nodes[i]
+			result.Edges[i], result.Edges[j] = result.Edges[j], result.Edges[i]
+		}
+	}
+	cursors := make([]string, len(result.Edges))
+	for i, edge := range result.Edges {
+		cursors[i] = edge.Cursor
+	}
+	result.PageInfo = page.info(posts.More, cursors)
+	return result
 }
 
-func queryPostList(ctx context.Context, query *datastore.Query) (PostListResult, error) {
-	query = query.Order("-CreatedAt") // order by creation time
-	var result PostListResult
-	keys, err := query.GetAll(ctx, &result.Nodes) // run the query
+// userOrder reads the `orderBy` argument of the users list
+func userOrder(args map[string]interface{}) (field store.UserOrder, descending bool, name string) {
+	orderBy, _ := args["orderBy"].(map[string]interface{})
+	fieldName, _ := orderBy["field"].(string)
+	direction, _ := orderBy["direction"].(string)
+	if fieldName == "" {
+		fieldName = "NAME"
+	}
+	if direction == "" {
+		direction = "ASC"
+	}
+	if fieldName == "CREATED_AT" {
+		field = store.UserOrderCreatedAt
+	}
+	return field, direction == "DESC", fieldName + "_" + direction
+}
+
+// QueryUsers function
+func QueryUsers(params graphql.ResolveParams) (interface{}, error) {
+	ctx := params.Context
+
+	var query store.UserQuery
+	query.NamePrefix, _ = params.Args["nameStartsWith"].(string)
+	var descending bool
+	var order string
+	query.OrderBy, descending, order = userOrder(params.Args)
+	if query.NamePrefix != "" && query.OrderBy != store.UserOrderName {
+		return nil, apperrors.InvalidArgumentf("nameStartsWith can only be combined with ordering by NAME")
+	}
+	result := UserListResult{countQuery: query}
+
+	page, err := parsePageArgs(params.Args)
 	if err != nil {
-		return result, err
-	} else {
-		for i, key := range keys { // set IDs
-			result.Nodes[i].ID = strconv.FormatInt(key.IntID(), 10)
+		return nil, err
+	}
+	if err := page.checkOrder(order); err != nil {
+		return nil, err
+	}
+
+	// bounds that cannot resume the query are applied as filters on the sort key,
+	// `after` bounds the list from below when it is ascending and from above when descending
+	resume := page.resume()
+	if resume != nil {
+		query.Start = resume.Position
+	}
+	for _, bound := range []struct {
+		cursor *cursor
+		above  bool // whether the list continues above the sort key of cursor
+	}{{page.After, !descending}, {page.Before, descending}} {
+		if bound.cursor == nil || bound.cursor == resume {
+			continue
+		}
+		switch {
+		case query.OrderBy == store.UserOrderName && bound.above:
+			query.NameAfter = bound.cursor.Name
+		case query.OrderBy == store.UserOrderName:
+			query.NameBefore = bound.cursor.Name
+		case bound.above:
+			query.CreatedAfter = bound.cursor.CreatedAt
+		default:
+			query.CreatedBefore = bound.cursor.CreatedAt
+		}
+	}
+	query.Descending = descending != page.Last // walk backwards and reverse the page afterwards
+	query.Offset = page.Offset
+	query.Limit = page.First
+
+	users, err := store.FromContext(ctx).ListUsers(ctx, query)
+	if err != nil {
+		return nil, storeError(err, "User")
+	}
+
+	result.Nodes = users.Users
+	result.Edges = make([]UserEdge, len(result.Nodes))
+	for i, user := range result.Nodes {
+		c := cursor{Reverse: page.Last, Order: order}
+		if query.OrderBy == store.UserOrderName {
+			c.Name = user.Name
+		} else {
+			c.CreatedAt = user.CreatedAt
+		}
+		if i == len(result.Nodes)-1 {
+			c.Position = users.End
 		}
-		result.TotalCount = len(result.Nodes) // set total count
+		result.Edges[i] = UserEdge{Node: user, Cursor: encodeCursor(c)}
+	}
+	if page.Last { // restore the requested order
+		for i, j := 0, len(result.Nodes)-1; i < j; i, j = i+1, j-1 {
+			result.Nodes[i], result.Nodes[j] = result.Nodes[j], result.Nodes[i]
+			result.Edges[i], result.Edges[j] = result.Edges[j], result.Edges[i]
+		}
+	}
+	cursors := make([]string, len(result.Edges))
+	for i, edge := range result.Edges {
+		cursors[i] = edge.Cursor
 	}
+	result.PageInfo = page.info(users.More, cursors)
 	return result, nil
 }
 
+// ResolveUserCreatedAt function returns null for users stored before creation times were recorded
+func ResolveUserCreatedAt(params graphql.ResolveParams) (interface{}, error) {
+	var createdAt time.Time
+	switch user := params.Source.(type) {
+	case *m.User:
+		createdAt = user.CreatedAt
+	case m.User:
+		createdAt = user.CreatedAt
+	}
+	if createdAt.IsZero() {
+		return nil, nil
+	}
+	return createdAt, nil
+}
+
 // QueryPosts function
 func QueryPosts(params graphql.ResolveParams) (interface{}, error) {
 	ctx := params.Context
-	query := datastore.NewQuery("Post")
-	limit, ok := params.Args["limit"].(int)
-	if ok {
-		query = query.Limit(limit)
-	}
-	offset, ok := params.Args["offset"].(int)
-	if ok {
-		query = query.Offset(offset)
-	}
-	return queryPostList(ctx, query)
+	return queryPostList(ctx, store.PostQuery{}, params.Args)
 }
 
-// CreateUser function
+// AnonymousPosts lets requests without a token post as any user, as they could before posting required one
+var AnonymousPosts bool
+
+// userTokenTTL is the lifetime of the token createUser hands out, new ones are issued with cmd/token
+const userTokenTTL = 90 * 24 * time.Hour
+
+// CreateUser function returns the new user, along with a token acting as them when the server signs tokens
 func CreateUser(params graphql.ResolveParams) (interface{}, error) {
 	ctx := params.Context
 
 	// Get the name argument
 	name, _ := params.Args["name"].(string)
-	user := &m.User{Name: name}
-	key := datastore.NewIncompleteKey(ctx, "User", nil)
-
-	// Insert user into Datastore
-	generatedKey, err := datastore.Put(ctx, key, user)
+	name, err := validate.UserName.Clean("name", name)
 	if err != nil {
-		return m.User{}, err
+		return nil, err
 	}
-	user.ID = strconv.FormatInt(generatedKey.IntID(), 10)
-	return user, nil
+	user := &m.User{Name: name, CreatedAt: time.Now().UTC()}
+
+	// Insert user into the store
+	if err := store.FromContext(ctx).PutUser(ctx, user); err != nil {
+		return nil, storeError(err, "User")
+	}
+	created := createdUser{user: user}
+	if signer := auth.SignerFromContext(ctx); signer != nil {
+		token := signer.Sign(auth.Viewer{UserID: user.ID}, time.Now().Add(userTokenTTL))
+		created.token = &token
+	}
+	return created, nil
 }
 
 // CreatePost function
@@ -71,59 +459,276 @@ func CreatePost(params graphql.ResolveParams) (interface{}, error) {
 
 	// Get the arguments
 	content, _ := params.Args["content"].(string)
-	userID, _ := params.Args["userID"].(string)
-	post := &m.Post{UserID: userID, Content: content, CreatedAt: time.Now().UTC()}
-	key := datastore.NewIncompleteKey(ctx, "Post", nil)
+	content, err := validate.PostContent.Clean("content", content)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := params.Args["userID"].(string) // decoded by the UserID scalar
+	switch viewer := auth.FromContext(ctx); {
+	case !viewer.Authenticated() && AnonymousPosts:
+	case !viewer.Authenticated():
+		return nil, apperrors.Unauthenticatedf("Sign in to post as user %s", GlobalID(UserNode, userID))
+	case !viewer.CanEdit(userID):
+		return nil, apperrors.Forbiddenf("Only user %s can post as themselves", GlobalID(UserNode, userID))
+	}
+	now := time.Now().UTC()
+	post := &m.Post{UserID: userID, Content: content, CreatedAt: now, UpdatedAt: now}
+
+	// Insert post into the store, once the user is known to exist
+	s := store.FromContext(ctx)
+	err = s.RunInTransaction(ctx, func(ctx context.Context) error { // a concurrent deleteUser makes the transaction retry or fail
+		if _, err := s.GetUser(ctx, userID); err != nil {
+			return err
+		}
+		return s.PutPost(ctx, post)
+	})
+	if err != nil {
+		return nil, userError(err, "userID", userID)
+	}
+	loaders.FromContext(ctx).ForgetPosts()
+	syncPostIndex(ctx, post.ID, post)
+	publishPost(ctx, pubsub.PostCreated, *post)
+	return post, nil
+}
+
+// postError maps the store errors of a lookup by the id in argument field onto typed errors for the client
+func postError(err error, field, id string) error {
+	switch err {
+	case store.ErrInvalidID:
+		return apperrors.InvalidArgumentf("Invalid id %q", id).OnField(field)
+	case store.ErrNotFound:
+		return apperrors.NotFoundf("Post %s not found", GlobalID(PostNode, id)).OnField(field)
+	default:
+		return apperrors.InternalError(err)
+	}
+}
+
+// editablePost loads a post the viewer is allowed to change, ctx should belong to a transaction
+func editablePost(ctx context.Context, id string) (*m.Post, error) {
+	viewer := auth.FromContext(ctx)
+	if !viewer.Authenticated() {
+		return nil, apperrors.Unauthenticatedf("Sign in to change post %s", GlobalID(PostNode, id))
+	}
+	post, err := store.FromContext(ctx).GetPost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !viewer.CanEdit(post.UserID) {
+		return nil, apperrors.Forbiddenf("Only the author of post %s can change it", GlobalID(PostNode, id))
+	}
+	return post, nil
+}
+
+// UpdatePost function
+func UpdatePost(params graphql.ResolveParams) (interface{}, error) {
+	ctx := params.Context
+	s := store.FromContext(ctx)
+
+	// Get the arguments
+	id, _ := params.Args["id"].(string)
+	content, _ := params.Args["content"].(string)
+	content, err := validate.PostContent.Clean("content", content)
+	if err != nil {
+		return nil, err
+	}
+
+	var post *m.Post
+	err = s.RunInTransaction(ctx, func(ctx context.Context) error { // check ownership and write atomically
+		var err error
+		if post, err = editablePost(ctx, id); err != nil {
+			return err
+		}
+		post.Content = content
+		post.UpdatedAt = time.Now().UTC()
+		return s.PutPost(ctx, post)
+	})
+	if err != nil {
+		return nil, postError(err, "id", id)
+	}
+	loaders.FromContext(ctx).ForgetPosts()
+	syncPostIndex(ctx, id, post)
+	publishPost(ctx, pubsub.PostUpdated, *post)
+	return post, nil
+}
 
-	// Insert post into Datastore
-	generatedKey, err := datastore.Put(ctx, key, post)
+// DeletePost function returns the deleted post
+func DeletePost(params graphql.ResolveParams) (interface{}, error) {
+	ctx := params.Context
+	s := store.FromContext(ctx)
+
+	id, _ := params.Args["id"].(string)
+	var post *m.Post
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if post, err = editablePost(ctx, id); err != nil {
+			return err
+		}
+		return s.DeletePost(ctx, id)
+	})
 	if err != nil {
-		return m.Post{}, err
+		return nil, postError(err, "id", id)
 	}
-	post.ID = strconv.FormatInt(generatedKey.IntID(), 10)
+	loaders.FromContext(ctx).ForgetPosts()
+	syncPostIndex(ctx, id, nil)
+	publishPost(ctx, pubsub.PostDeleted, *post)
 	return post, nil
 }
 
+// ResolvePostUpdatedAt function falls back to the creation time for posts stored before edits were recorded
+func ResolvePostUpdatedAt(params graphql.ResolveParams) (interface{}, error) {
+	var post m.Post
+	switch source := params.Source.(type) {
+	case *m.Post:
+		post = *source
+	case m.Post:
+		post = source
+	}
+	if post.UpdatedAt.IsZero() {
+		return post.CreatedAt, nil
+	}
+	return post.UpdatedAt, nil
+}
+
 // QueryUser function
 func QueryUser(params graphql.ResolveParams) (interface{}, error) {
 	ctx := params.Context
 
 	strID, ok := params.Args["id"].(string)
 	if ok {
-		id, err := strconv.ParseInt(strID, 10, 64) // Parse ID argument
-		if err != nil {
-			return nil, errors.New("Invalid id")
-		}
-		user := &m.User{ID: strID}
-		key := datastore.NewKey(ctx, "User", "", id, nil)
-
-		err = datastore.Get(ctx, key, user) // Fetch user by ID
+		user, err := store.FromContext(ctx).GetUser(ctx, strID) // Fetch user by ID
 		if err != nil {
-			return nil, errors.New("User not found")
+			return nil, userError(err, "id", strID)
 		}
 		return user, nil
 	}
 	return m.User{}, nil
 }
 
+// userError maps the store errors of a lookup by the id in argument field onto typed errors for the client
+func userError(err error, field, id string) error {
+	switch err {
+	case store.ErrInvalidID:
+		return apperrors.InvalidArgumentf("Invalid id %q", id).OnField(field)
+	case store.ErrNotFound:
+		return apperrors.NotFoundf("User %s not found", GlobalID(UserNode, id)).OnField(field)
+	default:
+		return apperrors.InternalError(err)
+	}
+}
+
+// editableUser loads a user the viewer is allowed to change, ctx should belong to a transaction
+func editableUser(ctx context.Context, id string) (*m.User, error) {
+	viewer := auth.FromContext(ctx)
+	if !viewer.Authenticated() {
+		return nil, apperrors.Unauthenticatedf("Sign in to change user %s", GlobalID(UserNode, id))
+	}
+	if !viewer.CanEdit(id) {
+		return nil, apperrors.Forbiddenf("Only user %s can change their account", GlobalID(UserNode, id))
+	}
+	return store.FromContext(ctx).GetUser(ctx, id)
+}
+
+// UpdateUser function
+func UpdateUser(params graphql.ResolveParams) (interface{}, error) {
+	ctx := params.Context
+	s := store.FromContext(ctx)
+
+	// Get the arguments
+	id, _ := params.Args["id"].(string)
+	name, _ := params.Args["name"].(string)
+	name, err := validate.UserName.Clean("name", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *m.User
+	err = s.RunInTransaction(ctx, func(ctx context.Context) error { // check permission, read and write the user atomically
+		var err error
+		if user, err = editableUser(ctx, id); err != nil {
+			return err
+		}
+		user.Name = name
+		return s.PutUser(ctx, user)
+	})
+	if err != nil {
+		return nil, userError(err, "id", id)
+	}
+	loaders.FromContext(ctx).ForgetUser(id)
+	return user, nil
+}
+
+// DeleteUser function removes a user along with their posts, and returns the deleted user
+func DeleteUser(params graphql.ResolveParams) (interface{}, error) {
+	ctx := params.Context
+	s := store.FromContext(ctx)
+
+	id, _ := params.Args["id"].(string)
+	var user *m.User
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if user, err = editableUser(ctx, id); err != nil {
+			return err
+		}
+		return s.DeleteUser(ctx, id)
+	})
+	if err != nil {
+		return nil, userError(err, "id", id)
+	}
+	loaders.FromContext(ctx).ForgetUser(id)
+	defer loaders.FromContext(ctx).ForgetPosts()
+
+	// delete the posts of small accounts right away, and leave large accounts,
+	// or a failed attempt, to a background task
+	more, err := deleteUserPosts(ctx, id, 1)
+	if more || err != nil {
+		if err := tasks.FromContext(ctx).Enqueue(ctx, deleteUserPostsTask, id); err != nil {
+			// the user is gone, their remaining posts are orphans for cmd/checkposts to repair
+			log.Printf("Failed to enqueue the deletion of the posts of user %s: %v", id, err)
+		}
+	}
+	return user, nil
+}
+
 // QueryPostsByUser function
 func QueryPostsByUser(params graphql.ResolveParams) (interface{}, error) {
 	ctx := params.Context
-	query := datastore.NewQuery("Post")
+	var query store.PostQuery
 
-	limit, ok := params.Args["limit"].(int)
-	if ok {
-		query = query.Limit(limit)
-	}
-	offset, ok := params.Args["offset"].(int)
-	if ok {
-		query = query.Offset(offset)
+	// check user's ID against post's UserID field, `user` resolves a *m.User and `users` lists m.User values
+	switch user := params.Source.(type) {
+	case *m.User:
+		query.UserID = user.ID
+	case m.User:
+		query.UserID = user.ID
+	default:
+		return nil, nil
 	}
+	return queryPostList(ctx, query, params.Args)
+}
 
-	// check user's ID against post's UserID field
-	user, ok := params.Source.(*m.User)
-	if ok {
-		query = query.Filter("UserID =", user.ID)
+// QueryPostAuthor function
+func QueryPostAuthor(params graphql.ResolveParams) (interface{}, error) {
+	ctx := params.Context
+
+	var userID string
+	switch post := params.Source.(type) {
+	case *m.Post:
+		userID = post.UserID
+	case m.Post:
+		userID = post.UserID
+	default:
+		return nil, nil
 	}
-	return queryPostList(ctx, query)
+
+	thunk := loaders.FromContext(ctx).User(ctx, userID) // fetched along with the other authors of this level
+	return func() (interface{}, error) {
+		user, err := thunk()
+		if err == store.ErrNotFound || err == store.ErrInvalidID { // the author is gone
+			return nil, nil
+		}
+		if err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		return user, nil
+	}, nil
 }
@@ -0,0 +1,175 @@
+package resolvers
+
+import (
+	"context"
+	"log"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/loaders"
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+	"github.com/graphql-go/graphql"
+)
+
+// indexPostTask brings the search document of a post in line with the store, it
+// catches up with the writes whose index update failed
+const indexPostTask = "indexPost"
+
+// ReindexPostsTask indexes every stored post, from the store cursor in its argument
+const ReindexPostsTask = "reindexPosts"
+
+// reindexBatches is the number of batches a reindexPosts task indexes before it enqueues its continuation
+const reindexBatches = 10
+
+// searchOrder is the order of the cursors of searchPosts, telling them apart from list cursors
+const searchOrder = "SEARCH"
+
+// Bounds of the `first` argument of searchPosts
+const (
+	defaultSearchFirst = 10
+	maxSearchFirst     = 100
+)
+
+func init() {
+	tasks.Register(indexPostTask, indexPost)
+	tasks.Register(ReindexPostsTask, reindexPosts)
+}
+
+// indexPost indexes the stored post id, or removes it from the index when it is gone
+func indexPost(ctx context.Context, id string) error {
+	post, err := store.FromContext(ctx).GetPost(ctx, id)
+	switch err {
+	case nil:
+		return search.FromContext(ctx).PutPosts(ctx, []m.Post{*post})
+	case store.ErrNotFound, store.ErrInvalidID:
+		return search.FromContext(ctx).DeletePosts(ctx, []string{id})
+	default:
+		return err
+	}
+}
+
+// reindexPosts indexes a few batches of posts from the cursor start, then
+// enqueues itself to carry on where it stopped
+func reindexPosts(ctx context.Context, start string) error {
+	query := store.PostQuery{Start: start, Limit: search.MaxBatchSize}
+	for batch := 0; batch < reindexBatches; batch++ {
+		page, err := store.FromContext(ctx).ListPosts(ctx, query)
+		if err != nil {
+			return err
+		}
+		if len(page.Posts) > 0 {
+			if err := search.FromContext(ctx).PutPosts(ctx, page.Posts); err != nil {
+				return err
+			}
+		}
+		if !page.More {
+			log.Printf("%s: every post is indexed", ReindexPostsTask)
+			return nil
+		}
+		query.Start = page.End
+	}
+	return tasks.FromContext(ctx).Enqueue(ctx, ReindexPostsTask, query.Start)
+}
+
+// syncPostIndex updates the search document of post id after a committed write,
+// post is nil once it is deleted. The write stands when the index cannot follow,
+// a task retries the update instead.
+func syncPostIndex(ctx context.Context, id string, post *m.Post) {
+	var err error
+	if post != nil {
+		err = search.FromContext(ctx).PutPosts(ctx, []m.Post{*post})
+	} else {
+		err = search.FromContext(ctx).DeletePosts(ctx, []string{id})
+	}
+	if err == nil {
+		return
+	}
+	if err := tasks.FromContext(ctx).Enqueue(ctx, indexPostTask, id); err != nil {
+		log.Printf("Failed to index post %s: %v", id, err)
+	}
+}
+
+// PostSearchResult struct
+type PostSearchResult struct {
+	Nodes    []m.Post   `json:"nodes"`
+	Edges    []PostEdge `json:"edges"`
+	PageInfo PageInfo   `json:"pageInfo"`
+
+	text  string // of the search, counted again by the indexes that are a search.Counter
+	total int    // reported by the other indexes, an estimate for large results
+}
+
+// totalCount returns the number of matches the index reported, or counts them
+func (result PostSearchResult) totalCount(ctx context.Context) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		counter, ok := search.FromContext(ctx).(search.Counter)
+		if !ok {
+			return result.total, nil
+		}
+		count, err := counter.CountPosts(ctx, result.text)
+		if err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		return count, nil
+	}
+}
+
+// QuerySearchPosts function returns the posts whose content matches `query`, newest first
+func QuerySearchPosts(params graphql.ResolveParams) (interface{}, error) {
+	ctx := params.Context
+
+	text, _ := params.Args["query"].(string)
+	first, ok := params.Args["first"].(int)
+	if !ok {
+		first = defaultSearchFirst
+	}
+	if first < 0 || first > maxSearchFirst {
+		return nil, apperrors.InvalidArgumentf("first must be between 0 and %d", maxSearchFirst).OnField("first")
+	}
+	query := search.Query{Text: text, Limit: first}
+	var args pageArgs
+	if after, _ := params.Args["after"].(string); after != "" {
+		c, err := decodeCursor("after", after)
+		if err != nil {
+			return nil, err
+		}
+		if c.Order != searchOrder {
+			return nil, apperrors.InvalidArgumentf("Invalid cursor for after, it does not belong to a search")
+		}
+		args.After, query.Start = c, c.Position
+	}
+
+	page, err := search.FromContext(ctx).SearchPosts(ctx, query)
+	if err == search.ErrInvalidQuery {
+		return nil, apperrors.InvalidArgumentf("Invalid search query or cursor").OnField("query")
+	}
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	// fetch the matching posts along with the other posts of this level
+	thunks := make([]func() (*m.Post, error), len(page.PostIDs))
+	for i, id := range page.PostIDs {
+		thunks[i] = loaders.FromContext(ctx).Post(ctx, id)
+	}
+	return func() (interface{}, error) {
+		result := PostSearchResult{text: text, total: page.Total}
+		cursors := make([]string, len(thunks)) // every match keeps its place in the page info, even when it is skipped
+		for i, thunk := range thunks {
+			cursors[i] = encodeCursor(cursor{Position: page.Cursors[i], Order: searchOrder})
+			post, err := thunk()
+			if err == store.ErrNotFound || err == store.ErrInvalidID { // deleted since it was indexed
+				continue
+			}
+			if err != nil {
+				return nil, storeError(err, "Post")
+			}
+			result.Nodes = append(result.Nodes, *post)
+			result.Edges = append(result.Edges, PostEdge{Node: *post, Cursor: cursors[i]})
+		}
+		result.PageInfo = args.info(page.More, cursors)
+		return result, nil
+	}, nil
+}
@@ -0,0 +1,38 @@
+package resolvers
+
+import (
+	"context"
+	"log"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/graphql-go/graphql"
+)
+
+// EventRootKey is the key of the root object holding the pubsub.Event a subscription
+// operation is executed for
+const EventRootKey = "event"
+
+// publishPost announces a committed change of post, subscribers missing it do not undo the change
+func publishPost(ctx context.Context, topic string, post m.Post) {
+	if err := pubsub.FromContext(ctx).Publish(ctx, pubsub.Event{Topic: topic, Post: post}); err != nil {
+		log.Printf("Failed to publish %s for post %s: %v", topic, post.ID, err)
+	}
+}
+
+// SubscribePost function returns the resolver of the subscription field of topic. It yields the
+// post of the event the operation runs for, or null when the event is filtered out by `userID`
+// or the operation runs without an event to check its arguments.
+func SubscribePost(topic string) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		root, _ := params.Info.RootValue.(map[string]interface{})
+		event, ok := root[EventRootKey].(pubsub.Event)
+		if !ok || event.Topic != topic {
+			return nil, nil
+		}
+		if userID, ok := params.Args["userID"].(string); ok && userID != event.Post.UserID {
+			return nil, nil
+		}
+		return event.Post, nil
+	}
+}
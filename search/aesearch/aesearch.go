@@ -0,0 +1,127 @@
+package aesearch
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	appsearch "google.golang.org/appengine/search"
+)
+
+// indexName is the name of the App Engine search index holding the posts
+const indexName = "posts"
+
+// rankEpoch is the origin of the default document ranks of the search API
+var rankEpoch = time.Date(2011, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Index implements search.Index with the App Engine search API
+type Index struct{}
+
+// New function
+func New() *Index {
+	return &Index{}
+}
+
+// postDoc is the search document of a post, ranked by creation time so that
+// the newest posts come first whenever they were indexed
+type postDoc struct {
+	post m.Post
+}
+
+// Save function
+func (d postDoc) Save() ([]appsearch.Field, *appsearch.DocumentMetadata, error) {
+	fields := []appsearch.Field{
+		{Name: "Content", Value: d.post.Content},
+		{Name: "UserID", Value: appsearch.Atom(d.post.UserID)},
+		{Name: "CreatedAt", Value: d.post.CreatedAt},
+	}
+	rank := int(d.post.CreatedAt.Sub(rankEpoch) / time.Second)
+	if rank <= 0 {
+		rank = 1
+	}
+	return fields, &appsearch.DocumentMetadata{Rank: rank}, nil
+}
+
+// Load function, search results are read as IDs only
+func (d *postDoc) Load(fields []appsearch.Field, meta *appsearch.DocumentMetadata) error {
+	return nil
+}
+
+// PutPosts function
+func (x *Index) PutPosts(ctx context.Context, posts []m.Post) error {
+	index, err := appsearch.Open(indexName)
+	if err != nil {
+		return err
+	}
+	for len(posts) > 0 {
+		n := len(posts)
+		if n > search.MaxBatchSize {
+			n = search.MaxBatchSize
+		}
+		ids := make([]string, n)
+		docs := make([]interface{}, n)
+		for i, post := range posts[:n] {
+			ids[i], docs[i] = post.ID, &postDoc{post: post}
+		}
+		if _, err := index.PutMulti(ctx, ids, docs); err != nil {
+			return err
+		}
+		posts = posts[n:]
+	}
+	return nil
+}
+
+// DeletePosts function
+func (x *Index) DeletePosts(ctx context.Context, ids []string) error {
+	index, err := appsearch.Open(indexName)
+	if err != nil {
+		return err
+	}
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > search.MaxBatchSize {
+			n = search.MaxBatchSize
+		}
+		if err := index.DeleteMulti(ctx, ids[:n]); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// SearchPosts function
+func (x *Index) SearchPosts(ctx context.Context, query search.Query) (search.Page, error) {
+	var page search.Page
+	index, err := appsearch.Open(indexName)
+	if err != nil {
+		return page, err
+	}
+	it := index.Search(ctx, query.Text, &appsearch.SearchOptions{
+		IDsOnly: true,
+		Limit:   query.Limit + 1, // one extra document to learn whether another page follows
+		Cursor:  appsearch.Cursor(query.Start),
+	})
+	for {
+		id, err := it.Next(nil)
+		if err == appsearch.Done {
+			break
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "INVALID_REQUEST") { // the query does not parse, or the cursor is not one of ours
+				return page, search.ErrInvalidQuery
+			}
+			return page, err
+		}
+		if len(page.PostIDs) == query.Limit {
+			page.More = true
+			break
+		}
+		page.PostIDs = append(page.PostIDs, id)
+		page.Cursors = append(page.Cursors, string(it.Cursor()))
+	}
+	page.Total = it.Count()
+	return page, nil
+}
@@ -0,0 +1,106 @@
+package memsearch
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+)
+
+// Index implements search.Index in process, for local development and for the
+// backends without a search service. A post matches when it contains every word
+// of the query, the newest posts come first.
+type Index struct {
+	mu    sync.Mutex
+	posts map[string]document
+}
+
+// document is an indexed post
+type document struct {
+	post  m.Post
+	words map[string]bool
+}
+
+// New returns an empty index
+func New() *Index {
+	return &Index{posts: map[string]document{}}
+}
+
+// PutPosts function
+func (x *Index) PutPosts(ctx context.Context, posts []m.Post) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, post := range posts {
+		doc := document{post: post, words: map[string]bool{}}
+		for _, word := range search.Words(post.Content) {
+			doc.words[word] = true
+		}
+		x.posts[post.ID] = doc
+	}
+	return nil
+}
+
+// DeletePosts function
+func (x *Index) DeletePosts(ctx context.Context, ids []string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, id := range ids {
+		delete(x.posts, id)
+	}
+	return nil
+}
+
+// SearchPosts function, cursors are offsets into the matches
+func (x *Index) SearchPosts(ctx context.Context, query search.Query) (search.Page, error) {
+	var page search.Page
+	terms := search.Words(query.Text)
+	if len(terms) == 0 {
+		return page, search.ErrInvalidQuery
+	}
+	offset := 0
+	if query.Start != "" {
+		var err error
+		if offset, err = strconv.Atoi(query.Start); err != nil || offset < 0 {
+			return page, search.ErrInvalidQuery
+		}
+	}
+
+	x.mu.Lock()
+	var matches []m.Post
+	for _, doc := range x.posts {
+		if containsAll(doc.words, terms) {
+			matches = append(matches, doc.post)
+		}
+	}
+	x.mu.Unlock()
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].ID > matches[j].ID
+	})
+
+	page.Total = len(matches)
+	for i := offset; i < len(matches); i++ {
+		if len(page.PostIDs) == query.Limit {
+			page.More = true
+			break
+		}
+		page.PostIDs = append(page.PostIDs, matches[i].ID)
+		page.Cursors = append(page.Cursors, strconv.Itoa(i+1))
+	}
+	return page, nil
+}
+
+// containsAll reports whether every term is among words
+func containsAll(words map[string]bool, terms []string) bool {
+	for _, term := range terms {
+		if !words[term] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package memsearch
+
+import (
+	"context"
+	"testing"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/searchtest"
+)
+
+func TestIndex(t *testing.T) {
+	searchtest.Run(t, func(t *testing.T, posts []m.Post) search.Index {
+		x := New()
+		if err := x.PutPosts(context.Background(), posts); err != nil {
+			t.Fatal(err)
+		}
+		return x
+	})
+}
+
+func TestDeletePosts(t *testing.T) {
+	ctx := context.Background()
+	x := New()
+	if err := x.PutPosts(ctx, searchtest.Posts); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.DeletePosts(ctx, []string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	edited := searchtest.Posts[0]
+	edited.Content = "Goodbye"
+	if err := x.PutPosts(ctx, []m.Post{edited}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := x.SearchPosts(ctx, search.Query{Text: "hello", Limit: 10})
+	if err != nil || len(page.PostIDs) != 0 {
+		t.Errorf("SearchPosts after deleting and editing = %v, %v, want no matches", page.PostIDs, err)
+	}
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+)
+
+// Errors returned by every Index implementation
+var (
+	ErrInvalidQuery = errors.New("search: invalid query")
+)
+
+// MaxBatchSize is the largest number of posts indexed or removed in one call
+const MaxBatchSize = 200
+
+// Query describes a page of search results
+type Query struct {
+	Text  string // words the posts must contain
+	Start string // cursor returned by a previous page of the same query
+	Limit int
+}
+
+// Page is a page of matching posts, best matches first
+type Page struct {
+	PostIDs []string
+	Cursors []string // cursor positioned after each post
+	More    bool     // whether matches follow the last one
+	Total   int      // number of matching posts, an estimate for large results, left out by a Counter
+}
+
+// Index keeps the content of posts searchable. It is derived from the store,
+// so it may lag behind it and is rebuilt by reindexing the posts.
+type Index interface {
+	PutPosts(ctx context.Context, posts []m.Post) error // adds or replaces the posts
+	DeletePosts(ctx context.Context, ids []string) error
+	SearchPosts(ctx context.Context, query Query) (Page, error)
+}
+
+// Counter is implemented by the indexes that count the matches with a query of their
+// own, their pages leave Total out so that searches only count when asked to
+type Counter interface {
+	CountPosts(ctx context.Context, text string) (int, error)
+}
+
+// Words splits text into the lower case words the in-process and SQL indexes match
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying x
+func NewContext(ctx context.Context, x Index) context.Context {
+	return context.WithValue(ctx, contextKey{}, x)
+}
+
+// FromContext returns the Index carried by ctx
+func FromContext(ctx context.Context) Index {
+	x, ok := ctx.Value(contextKey{}).(Index)
+	if !ok {
+		panic("search: no Index in context")
+	}
+	return x
+}
@@ -0,0 +1,111 @@
+// Package searchtest checks that an implementation of search.Index behaves like
+// the others, each index runs it from its own tests.
+package searchtest
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+)
+
+// Posts are the posts every index is tested on, oldest first
+var Posts = []m.Post{
+	{Content: "Hello world"},
+	{Content: "hello GraphQL WORLD"},
+	{Content: "GraphQL is pretty cool!"},
+	{Content: "World peace, now"},
+	{Content: "Nothing to see here"},
+}
+
+func init() {
+	for i := range Posts {
+		at := time.Date(2019, 12, 1, 10, i, 0, 0, time.UTC)
+		Posts[i].ID, Posts[i].UserID = strconv.Itoa(i+1), "1"
+		Posts[i].CreatedAt, Posts[i].UpdatedAt = at, at
+	}
+}
+
+// Run runs the contract against the indexes returned by newIndex, which searches the given posts
+func Run(t *testing.T, newIndex func(t *testing.T, posts []m.Post) search.Index) {
+	ctx := context.Background()
+	x := newIndex(t, Posts)
+
+	tests := []struct {
+		text string
+		want []string // ids of the matches
+	}{
+		{"hello", []string{"2", "1"}},
+		{"WORLD hello", []string{"2", "1"}},
+		{"graphql", []string{"3", "2"}},
+		{"cool, GraphQL.", []string{"3"}},
+		{"world", []string{"4", "2", "1"}},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		page, err := x.SearchPosts(ctx, search.Query{Text: test.text, Limit: 10})
+		if err != nil {
+			t.Errorf("SearchPosts(%q): %v", test.text, err)
+			continue
+		}
+		if total := total(t, x, test.text, page); !reflect.DeepEqual(page.PostIDs, test.want) || page.More || total != len(test.want) {
+			t.Errorf("SearchPosts(%q) = %v (more %v, total %d), want %v", test.text, page.PostIDs, page.More, total, test.want)
+		}
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		query := search.Query{Text: "world", Limit: 2}
+		var got []string
+		for pages := 0; ; pages++ {
+			if pages == 3 {
+				t.Fatal("SearchPosts never ends")
+			}
+			page, err := x.SearchPosts(ctx, query)
+			if err != nil {
+				t.Fatalf("SearchPosts(%+v): %v", query, err)
+			}
+			if len(page.Cursors) != len(page.PostIDs) || total(t, x, query.Text, page) != 3 {
+				t.Fatalf("SearchPosts(%+v) = %+v, want a cursor per post and a total of 3", query, page)
+			}
+			got = append(got, page.PostIDs...)
+			if !page.More {
+				break
+			}
+			query.Start = page.Cursors[len(page.Cursors)-1]
+		}
+		if want := []string{"4", "2", "1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("pages of SearchPosts = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("InvalidQueries", func(t *testing.T) {
+		for _, query := range []search.Query{{Text: " !? ", Limit: 10}, {Text: "world", Start: "nonsense", Limit: 10}} {
+			if _, err := x.SearchPosts(ctx, query); err != search.ErrInvalidQuery {
+				t.Errorf("SearchPosts(%+v): %v, want %v", query, err, search.ErrInvalidQuery)
+			}
+		}
+		if counter, ok := x.(search.Counter); ok {
+			if _, err := counter.CountPosts(ctx, " !? "); err != search.ErrInvalidQuery {
+				t.Errorf("CountPosts(%q): %v, want %v", " !? ", err, search.ErrInvalidQuery)
+			}
+		}
+	})
+}
+
+// total returns the number of matches of text, counted by x when it is a Counter
+func total(t *testing.T, x search.Index, text string, page search.Page) int {
+	t.Helper()
+	counter, ok := x.(search.Counter)
+	if !ok {
+		return page.Total
+	}
+	count, err := counter.CountPosts(context.Background(), text)
+	if err != nil {
+		t.Fatalf("CountPosts(%q): %v", text, err)
+	}
+	return count
+}
@@ -0,0 +1,102 @@
+package sqlsearch
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore"
+)
+
+// Index implements search.Index with LIKE queries on the posts table of sqlstore,
+// so every server of the sql backend searches the same, current posts. A post
+// matches when its content contains every word of the query, the newest posts
+// come first. Words also match inside longer words, and SQLite only folds the
+// case of ASCII letters.
+type Index struct {
+	db      *sql.DB
+	dialect sqlstore.Dialect
+}
+
+// New function
+func New(db *sql.DB, dialect sqlstore.Dialect) *Index {
+	return &Index{db: db, dialect: dialect}
+}
+
+// PutPosts function has nothing to do, the posts table is searched directly
+func (x *Index) PutPosts(ctx context.Context, posts []m.Post) error {
+	return nil
+}
+
+// DeletePosts function has nothing to do, the posts table is searched directly
+func (x *Index) DeletePosts(ctx context.Context, ids []string) error {
+	return nil
+}
+
+// SearchPosts function, cursors are offsets into the matches, and Total is left for CountPosts
+func (x *Index) SearchPosts(ctx context.Context, query search.Query) (search.Page, error) {
+	var page search.Page
+	conditions, args := matching(query.Text)
+	if conditions == "" {
+		return page, search.ErrInvalidQuery
+	}
+	offset := 0
+	if query.Start != "" {
+		var err error
+		if offset, err = strconv.Atoi(query.Start); err != nil || offset < 0 {
+			return page, search.ErrInvalidQuery
+		}
+	}
+
+	// fetch one extra row to learn whether another page follows
+	rows, err := x.db.QueryContext(ctx, x.dialect.Rebind("SELECT id"+conditions+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"),
+		append(args, query.Limit+1, offset)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return page, err
+		}
+		if len(page.PostIDs) == query.Limit {
+			page.More = true
+			break
+		}
+		page.PostIDs = append(page.PostIDs, strconv.FormatInt(id, 10))
+		page.Cursors = append(page.Cursors, strconv.Itoa(offset+len(page.PostIDs)))
+	}
+	return page, rows.Err()
+}
+
+// CountPosts function returns the number of posts SearchPosts matches with text
+func (x *Index) CountPosts(ctx context.Context, text string) (int, error) {
+	conditions, args := matching(text)
+	if conditions == "" {
+		return 0, search.ErrInvalidQuery
+	}
+	var count int
+	err := x.db.QueryRowContext(ctx, x.dialect.Rebind("SELECT COUNT(*)"+conditions), args...).Scan(&count)
+	return count, err
+}
+
+// matching returns the FROM and WHERE clauses selecting the posts that contain every
+// word of text, and their arguments. The clauses are empty when text has no word.
+func matching(text string) (string, []interface{}) {
+	terms := search.Words(text)
+	if len(terms) == 0 {
+		return "", nil
+	}
+	// words are made of letters and digits, never of LIKE wildcards
+	where := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		where[i] = "lower(content) LIKE ?"
+		args[i] = "%" + term + "%"
+	}
+	return " FROM posts WHERE " + strings.Join(where, " AND "), args
+}
@@ -0,0 +1,42 @@
+//go:build sqlite
+// +build sqlite
+
+package sqlsearch
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/searchtest"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore"
+	_ "github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore/drivers" // registers sqlite3
+)
+
+func TestIndex(t *testing.T) {
+	searchtest.Run(t, func(t *testing.T, posts []m.Post) search.Index {
+		ctx := context.Background()
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "graphql.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		migrations, err := sqlstore.LoadMigrations(sqlstore.MigrationsDir("../../store/sqlstore/migrations", sqlstore.SQLite))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sqlstore.Migrate(ctx, db, sqlstore.SQLite, migrations); err != nil {
+			t.Fatal(err)
+		}
+		s := sqlstore.New(db, sqlstore.SQLite)
+		for _, post := range posts {
+			if err := s.PutPost(ctx, &post); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return New(db, sqlstore.SQLite)
+	})
+}
@@ -0,0 +1,555 @@
+package aedatastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// Store implements store.Store on top of the App Engine datastore
+type Store struct{}
+
+// New function
+func New() *Store {
+	return &Store{}
+}
+
+// parseID converts a public ID into a datastore integer ID
+func parseID(id string) (int64, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || intID <= 0 {
+		return 0, store.ErrInvalidID
+	}
+	return intID, nil
+}
+
+// formatID converts a datastore key into a public ID
+func formatID(key *datastore.Key) string {
+	return strconv.FormatInt(key.IntID(), 10)
+}
+
+// translateError maps datastore errors onto the store package errors
+func translateError(err error) error {
+	if err == datastore.ErrNoSuchEntity {
+		return store.ErrNotFound
+	}
+	if err != nil && strings.Contains(err.Error(), "NEED_INDEX") {
+		return store.ErrNeedIndex
+	}
+	return err
+}
+
+// GetUser function
+func (s *Store) GetUser(ctx context.Context, id string) (*m.User, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	user := &m.User{}
+	if err := datastore.Get(ctx, datastore.NewKey(ctx, "User", "", intID, nil), user); err != nil {
+		return nil, translateError(err)
+	}
+	user.ID = id
+	return user, nil
+}
+
+// GetUsers function
+func (s *Store) GetUsers(ctx context.Context, ids []string) ([]*m.User, error) {
+	keys := make([]*datastore.Key, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = datastore.NewKey(ctx, "User", "", intID, nil)
+	}
+	users := make([]m.User, len(keys))
+	err := datastore.GetMulti(ctx, keys, users)
+	multiErr, _ := err.(appengine.MultiError)
+	if err != nil && multiErr == nil {
+		return nil, err
+	}
+	result := make([]*m.User, len(ids))
+	for i := range users {
+		if multiErr != nil && multiErr[i] != nil {
+			if multiErr[i] == datastore.ErrNoSuchEntity {
+				continue
+			}
+			return nil, multiErr[i]
+		}
+		users[i].ID = ids[i]
+		result[i] = &users[i]
+	}
+	return result, nil
+}
+
+// PutUser function
+func (s *Store) PutUser(ctx context.Context, user *m.User) error {
+	key := datastore.NewIncompleteKey(ctx, "User", nil)
+	if user.ID != "" {
+		intID, err := parseID(user.ID)
+		if err != nil {
+			return err
+		}
+		key = datastore.NewKey(ctx, "User", "", intID, nil)
+	}
+	generatedKey, err := datastore.Put(ctx, key, user)
+	if err != nil {
+		return err
+	}
+	user.ID = formatID(generatedKey)
+	return nil
+}
+
+// DeleteUser function
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	intID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	return datastore.Delete(ctx, datastore.NewKey(ctx, "User", "", intID, nil))
+}
+
+// userQuery builds the datastore query shared by ListUsers and CountUsers
+func userQuery(query store.UserQuery) *datastore.Query {
+	q := datastore.NewQuery("User")
+	if query.NamePrefix != "" {
+		q = q.Filter("Name >=", query.NamePrefix).Filter("Name <", store.PrefixEnd(query.NamePrefix))
+	}
+	if query.NameAfter != "" {
+		q = q.Filter("Name >", query.NameAfter)
+	}
+	if query.NameBefore != "" {
+		q = q.Filter("Name <", query.NameBefore)
+	}
+	if !query.CreatedAfter.IsZero() {
+		q = q.Filter("CreatedAt >", query.CreatedAfter)
+	}
+	if !query.CreatedBefore.IsZero() {
+		q = q.Filter("CreatedAt <", query.CreatedBefore)
+	}
+	order := "Name"
+	if query.OrderBy == store.UserOrderCreatedAt {
+		order = "CreatedAt"
+	}
+	if query.Descending {
+		return q.Order("-" + order)
+	}
+	return q.Order(order)
+}
+
+// ListUsers function
+func (s *Store) ListUsers(ctx context.Context, query store.UserQuery) (store.UserPage, error) {
+	var page store.UserPage
+	q, err := paginate(userQuery(query), query.Start, query.Offset, query.Limit)
+	if err != nil {
+		return page, err
+	}
+	page.End, page.More, err = readPage(ctx, q, query.Limit, func(it *datastore.Iterator, keep bool) error {
+		if !keep {
+			_, err := it.Next(nil)
+			return err
+		}
+		var user m.User
+		key, err := it.Next(&user)
+		if err != nil {
+			return err
+		}
+		user.ID = formatID(key)
+		page.Users = append(page.Users, user)
+		return nil
+	})
+	return page, err
+}
+
+// CountUsers function
+func (s *Store) CountUsers(ctx context.Context, query store.UserQuery) (int, error) {
+	return userQuery(query).KeysOnly().Count(ctx)
+}
+
+// Posts are stored under the key of their author, so the posts of a user are
+// read with strongly consistent ancestor queries. Their IDs are allocated from
+// the root Post path, which keeps them unique across users, and a PostOwner
+// entity with the same ID records the author so a post can be found from its
+// public ID alone. Posts stored before this layout live at the root until
+// MigratePostKeys moves them.
+
+// postOwner records the author of a post
+type postOwner struct {
+	UserID string
+}
+
+// postKey returns the key of a post under its author
+func postKey(ctx context.Context, userID string, intID int64) (*datastore.Key, error) {
+	userIntID, err := parseID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return datastore.NewKey(ctx, "Post", "", intID, datastore.NewKey(ctx, "User", "", userIntID, nil)), nil
+}
+
+// ownerKey returns the key of the PostOwner of a post
+func ownerKey(ctx context.Context, intID int64) *datastore.Key {
+	return datastore.NewKey(ctx, "PostOwner", "", intID, nil)
+}
+
+// rootPostKey returns the key a post had before it was stored under its author
+func rootPostKey(ctx context.Context, intID int64) *datastore.Key {
+	return datastore.NewKey(ctx, "Post", "", intID, nil)
+}
+
+// lookupPostKeys returns the keys of the posts with the given IDs, at the root for posts that were not migrated yet
+func lookupPostKeys(ctx context.Context, intIDs []int64) ([]*datastore.Key, error) {
+	ownerKeys := make([]*datastore.Key, len(intIDs))
+	for i, intID := range intIDs {
+		ownerKeys[i] = ownerKey(ctx, intID)
+	}
+	owners := make([]postOwner, len(intIDs))
+	err := datastore.GetMulti(ctx, ownerKeys, owners)
+	multiErr, _ := err.(appengine.MultiError)
+	if err != nil && multiErr == nil {
+		return nil, err
+	}
+	keys := make([]*datastore.Key, len(intIDs))
+	for i, intID := range intIDs {
+		if multiErr != nil && multiErr[i] != nil {
+			if multiErr[i] != datastore.ErrNoSuchEntity {
+				return nil, multiErr[i]
+			}
+			keys[i] = rootPostKey(ctx, intID)
+			continue
+		}
+		if keys[i], err = postKey(ctx, owners[i].UserID, intID); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// GetPost function
+func (s *Store) GetPost(ctx context.Context, id string) (*m.Post, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := lookupPostKeys(ctx, []int64{intID})
+	if err != nil {
+		return nil, err
+	}
+	post := &m.Post{}
+	if err := datastore.Get(ctx, keys[0], post); err != nil {
+		return nil, translateError(err)
+	}
+	post.ID = id
+	return post, nil
+}
+
+// PutPost function writes the post and its owner in one call, which is only
+// atomic inside a transaction. A post of the root layout is moved under its author.
+func (s *Store) PutPost(ctx context.Context, post *m.Post) error {
+	var intID int64
+	if post.ID == "" {
+		low, _, err := datastore.AllocateIDs(ctx, "Post", nil, 1)
+		if err != nil {
+			return err
+		}
+		intID = low
+	} else {
+		var err error
+		if intID, err = parseID(post.ID); err != nil {
+			return err
+		}
+	}
+	key, err := postKey(ctx, post.UserID, intID)
+	if err != nil {
+		return err
+	}
+	if _, err := datastore.PutMulti(ctx, []*datastore.Key{key, ownerKey(ctx, intID)}, []interface{}{post, &postOwner{UserID: post.UserID}}); err != nil {
+		return err
+	}
+	if post.ID != "" {
+		if err := datastore.Delete(ctx, rootPostKey(ctx, intID)); err != nil {
+			return err
+		}
+	}
+	post.ID = strconv.FormatInt(intID, 10)
+	return nil
+}
+
+// DeletePost function
+func (s *Store) DeletePost(ctx context.Context, id string) error {
+	return s.DeletePosts(ctx, []string{id})
+}
+
+// DeletePosts function
+func (s *Store) DeletePosts(ctx context.Context, ids []string) error {
+	intIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return err
+		}
+		intIDs[i] = intID
+	}
+	keys, err := lookupPostKeys(ctx, intIDs)
+	if err != nil {
+		return err
+	}
+	for _, intID := range intIDs {
+		keys = append(keys, ownerKey(ctx, intID))
+	}
+	return deleteKeys(ctx, keys)
+}
+
+// maxKeysPerCall is the largest number of keys the datastore accepts in one batch call
+const maxKeysPerCall = 500
+
+// deleteKeys removes the entities at keys, in as many calls as the datastore limit requires
+func deleteKeys(ctx context.Context, keys []*datastore.Key) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxKeysPerCall {
+			n = maxKeysPerCall
+		}
+		if err := datastore.DeleteMulti(ctx, keys[:n]); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// postQuery builds the datastore query shared by ListPosts and CountPosts
+func postQuery(ctx context.Context, query store.PostQuery) (*datastore.Query, error) {
+	q := datastore.NewQuery("Post")
+	if query.UserID != "" {
+		userIntID, err := parseID(query.UserID)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Ancestor(datastore.NewKey(ctx, "User", "", userIntID, nil))
+	}
+	if !query.CreatedAfter.IsZero() {
+		q = q.Filter("CreatedAt >", query.CreatedAfter)
+	}
+	if !query.CreatedBefore.IsZero() {
+		q = q.Filter("CreatedAt <", query.CreatedBefore)
+	}
+	if !query.UpdatedAfter.IsZero() {
+		q = q.Filter("UpdatedAt >", query.UpdatedAfter)
+	}
+	if !query.UpdatedBefore.IsZero() {
+		q = q.Filter("UpdatedAt <", query.UpdatedBefore)
+	}
+	order := "CreatedAt"
+	if query.OrderBy == store.PostOrderUpdatedAt {
+		order = "UpdatedAt" // posts stored before edits were recorded have no UpdatedAt, and are left out
+	}
+	if query.Descending {
+		return q.Order("-" + order), nil
+	}
+	return q.Order(order), nil
+}
+
+// ListPosts function
+func (s *Store) ListPosts(ctx context.Context, query store.PostQuery) (store.PostPage, error) {
+	var page store.PostPage
+	q, err := postQuery(ctx, query)
+	if err != nil {
+		return page, err
+	}
+	q, outside, err := postBounds(q, query)
+	if err != nil {
+		return page, err
+	}
+	limit, offset := query.Limit, 0
+	if outside != nil { // the posts left out count towards neither the offset nor the limit
+		offset, query.Offset, query.Limit = query.Offset, 0, -1
+	}
+	q, err = paginate(q, query.Start, query.Offset, query.Limit)
+	if err != nil {
+		return page, err
+	}
+	page.End, page.More, err = readPage(ctx, q, limit, func(it *datastore.Iterator, keep bool) error {
+		var post m.Post
+		key, err := it.Next(&post)
+		if err != nil {
+			return err
+		}
+		if outside != nil && outside(key, post) {
+			return errSkipped
+		}
+		if offset > 0 {
+			offset--
+			return errSkipped
+		}
+		if keep {
+			post.ID = formatID(key)
+			page.Posts = append(page.Posts, post)
+		}
+		return nil
+	})
+	return page, translateError(err)
+}
+
+// postBounds applies the After and Before positions of query to q. Queries cannot
+// compare the IDs of the posts tied with a position, so q takes those posts in and
+// outside reports the ones to leave out as they are read, outside is nil when there
+// are no positions.
+func postBounds(q *datastore.Query, query store.PostQuery) (*datastore.Query, func(key *datastore.Key, post m.Post) bool, error) {
+	if query.After == nil && query.Before == nil {
+		return q, nil, nil
+	}
+	property := "CreatedAt"
+	if query.OrderBy == store.PostOrderUpdatedAt {
+		property = "UpdatedAt"
+	}
+	var afterID, beforeID int64
+	var err error
+	if query.After != nil {
+		if afterID, err = parseID(query.After.ID); err != nil {
+			return nil, nil, store.ErrInvalidQuery
+		}
+		q = q.Filter(property+" >=", query.After.SortKey)
+	}
+	if query.Before != nil {
+		if beforeID, err = parseID(query.Before.ID); err != nil {
+			return nil, nil, store.ErrInvalidQuery
+		}
+		q = q.Filter(property+" <=", query.Before.SortKey)
+	}
+	return q, func(key *datastore.Key, post m.Post) bool {
+		sortKey := post.CreatedAt
+		if query.OrderBy == store.PostOrderUpdatedAt {
+			sortKey = post.UpdatedAt
+		}
+		return query.After != nil && sortKey.Equal(query.After.SortKey) && key.IntID() <= afterID ||
+			query.Before != nil && sortKey.Equal(query.Before.SortKey) && key.IntID() >= beforeID
+	}, nil
+}
+
+// CountPosts function
+func (s *Store) CountPosts(ctx context.Context, query store.PostQuery) (int, error) {
+	q, err := postQuery(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	count, err := q.KeysOnly().Count(ctx)
+	return count, translateError(err)
+}
+
+// MigratePostKeys moves up to limit posts of the root layout under their
+// author, keeping their IDs. It returns the cursor to resume from and whether
+// every post was visited, posts whose UserID is malformed stay where they are.
+func (s *Store) MigratePostKeys(ctx context.Context, start string, limit int) (string, bool, error) {
+	q, err := paginate(datastore.NewQuery("Post").KeysOnly(), start, 0, limit)
+	if err != nil {
+		return "", false, err
+	}
+	var rootKeys []*datastore.Key
+	end, more, err := readPage(ctx, q, limit, func(it *datastore.Iterator, keep bool) error {
+		key, err := it.Next(nil)
+		if err != nil {
+			return err
+		}
+		if keep && key.Parent() == nil {
+			rootKeys = append(rootKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	for _, rootKey := range rootKeys {
+		err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+			var post m.Post
+			if err := datastore.Get(ctx, rootKey, &post); err == datastore.ErrNoSuchEntity {
+				return nil // already moved, the query is eventually consistent
+			} else if err != nil {
+				return err
+			}
+			post.ID = formatID(rootKey)
+			return s.PutPost(ctx, &post) // also deletes the root entity
+		})
+		if err != nil && err != store.ErrInvalidID {
+			return "", false, err
+		}
+	}
+	return end, !more, nil
+}
+
+// RunInTransaction function
+func (s *Store) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return datastore.RunInTransaction(ctx, fn, &datastore.TransactionOptions{XG: true})
+}
+
+// paginate applies a start cursor, offset and limit to q, fetching one extra
+// entity to learn whether another page follows
+func paginate(q *datastore.Query, start string, offset, limit int) (*datastore.Query, error) {
+	if start != "" {
+		cursor, err := datastore.DecodeCursor(start)
+		if err != nil {
+			return nil, store.ErrInvalidQuery
+		}
+		q = q.Start(cursor)
+	}
+	if offset > 0 {
+		q = q.Offset(offset)
+	}
+	if limit >= 0 {
+		q = q.Limit(limit + 1)
+	}
+	return q, nil
+}
+
+// errSkipped is returned by the load function of readPage for the entities it leaves out
+var errSkipped = errors.New("aedatastore: entity left out")
+
+// readPage calls load for up to limit entities of q and returns the cursor
+// after the last one loaded, along with whether more entities follow. The
+// entities load skips count for neither, and load keeps nothing of the entity
+// readPage probes for once the page is full.
+func readPage(ctx context.Context, q *datastore.Query, limit int, load func(it *datastore.Iterator, keep bool) error) (string, bool, error) {
+	it := q.Run(ctx)
+	for loaded := 0; ; {
+		if loaded == limit {
+			cursor, err := it.Cursor() // taken before probing for the extra entity
+			if err != nil {
+				return "", false, err
+			}
+			end := cursor.String()
+			err = load(it, false)
+			for err == errSkipped {
+				err = load(it, false)
+			}
+			if err == datastore.Done {
+				return end, false, nil
+			} else if err != nil {
+				return "", false, err
+			}
+			return end, true, nil
+		}
+		err := load(it, true)
+		if err == datastore.Done {
+			break
+		}
+		if err == errSkipped {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		loaded++
+	}
+	cursor, err := it.Cursor()
+	if err != nil {
+		return "", false, err
+	}
+	return cursor.String(), false, nil
+}
@@ -0,0 +1,645 @@
+//go:build clouddatastore
+// +build clouddatastore
+
+package clouddatastore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"google.golang.org/api/iterator"
+)
+
+// Store implements store.Store with the standalone Cloud Datastore client,
+// which also talks to Firestore in Datastore mode and to the local emulator
+type Store struct {
+	client *datastore.Client
+}
+
+// New connects to the datastore of projectID, honouring DATASTORE_EMULATOR_HOST
+func New(ctx context.Context, projectID string) (*Store, error) {
+	client, err := datastore.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{client: client}, nil
+}
+
+// Client returns the datastore client of the store, for the other services of the backend
+func (s *Store) Client() *datastore.Client {
+	return s.client
+}
+
+// Close releases the client's connections
+func (s *Store) Close() error {
+	return s.client.Close()
+}
+
+type txKey struct{}
+
+// transaction returns the transaction ctx belongs to, if any
+func transaction(ctx context.Context) *datastore.Transaction {
+	tx, _ := ctx.Value(txKey{}).(*datastore.Transaction)
+	return tx
+}
+
+// RunInTransaction function
+func (s *Store) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := s.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+	return err
+}
+
+// parseID converts a public ID into a datastore integer ID
+func parseID(id string) (int64, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || intID <= 0 {
+		return 0, store.ErrInvalidID
+	}
+	return intID, nil
+}
+
+// formatID converts a datastore key into a public ID
+func formatID(key *datastore.Key) string {
+	return strconv.FormatInt(key.ID, 10)
+}
+
+// translateError maps datastore errors onto the store package errors
+func translateError(err error) error {
+	if err == datastore.ErrNoSuchEntity {
+		return store.ErrNotFound
+	}
+	if err != nil && strings.Contains(err.Error(), "no matching index found") {
+		return store.ErrNeedIndex
+	}
+	return err
+}
+
+// get loads the entity at key, inside the transaction of ctx when there is one
+func (s *Store) get(ctx context.Context, key *datastore.Key, dst interface{}) error {
+	if tx := transaction(ctx); tx != nil {
+		return translateError(tx.Get(key, dst))
+	}
+	return translateError(s.client.Get(ctx, key, dst))
+}
+
+// put saves src under kind, allocating an ID first when id is empty so that
+// the key is known even before a transaction commits
+func (s *Store) put(ctx context.Context, kind, id string, src interface{}) (string, error) {
+	var key *datastore.Key
+	if id == "" {
+		keys, err := s.client.AllocateIDs(ctx, []*datastore.Key{datastore.IncompleteKey(kind, nil)})
+		if err != nil {
+			return "", err
+		}
+		key = keys[0]
+	} else {
+		intID, err := parseID(id)
+		if err != nil {
+			return "", err
+		}
+		key = datastore.IDKey(kind, intID, nil)
+	}
+	var err error
+	if tx := transaction(ctx); tx != nil {
+		_, err = tx.Put(key, src)
+	} else {
+		_, err = s.client.Put(ctx, key, src)
+	}
+	if err != nil {
+		return "", err
+	}
+	return formatID(key), nil
+}
+
+// delete removes the entity of kind with the given id
+func (s *Store) delete(ctx context.Context, kind, id string) error {
+	intID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	key := datastore.IDKey(kind, intID, nil)
+	if tx := transaction(ctx); tx != nil {
+		return tx.Delete(key)
+	}
+	return s.client.Delete(ctx, key)
+}
+
+// GetUser function
+func (s *Store) GetUser(ctx context.Context, id string) (*m.User, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	user := &m.User{}
+	if err := s.get(ctx, datastore.IDKey("User", intID, nil), user); err != nil {
+		return nil, err
+	}
+	user.ID = id
+	return user, nil
+}
+
+// GetUsers function
+func (s *Store) GetUsers(ctx context.Context, ids []string) ([]*m.User, error) {
+	keys := make([]*datastore.Key, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = datastore.IDKey("User", intID, nil)
+	}
+	users := make([]m.User, len(keys))
+	var err error
+	if tx := transaction(ctx); tx != nil {
+		err = tx.GetMulti(keys, users)
+	} else {
+		err = s.client.GetMulti(ctx, keys, users)
+	}
+	multiErr, _ := err.(datastore.MultiError)
+	if err != nil && multiErr == nil {
+		return nil, err
+	}
+	result := make([]*m.User, len(ids))
+	for i := range users {
+		if multiErr != nil && multiErr[i] != nil {
+			if multiErr[i] == datastore.ErrNoSuchEntity {
+				continue
+			}
+			return nil, multiErr[i]
+		}
+		users[i].ID = ids[i]
+		result[i] = &users[i]
+	}
+	return result, nil
+}
+
+// PutUser function
+func (s *Store) PutUser(ctx context.Context, user *m.User) error {
+	id, err := s.put(ctx, "User", user.ID, user)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+// DeleteUser function
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	return s.delete(ctx, "User", id)
+}
+
+// userQuery builds the datastore query shared by ListUsers and CountUsers
+func userQuery(query store.UserQuery) *datastore.Query {
+	q := datastore.NewQuery("User")
+	if query.NamePrefix != "" {
+		q = q.Filter("Name >=", query.NamePrefix).Filter("Name <", store.PrefixEnd(query.NamePrefix))
+	}
+	if query.NameAfter != "" {
+		q = q.Filter("Name >", query.NameAfter)
+	}
+	if query.NameBefore != "" {
+		q = q.Filter("Name <", query.NameBefore)
+	}
+	if !query.CreatedAfter.IsZero() {
+		q = q.Filter("CreatedAt >", query.CreatedAfter)
+	}
+	if !query.CreatedBefore.IsZero() {
+		q = q.Filter("CreatedAt <", query.CreatedBefore)
+	}
+	order := "Name"
+	if query.OrderBy == store.UserOrderCreatedAt {
+		order = "CreatedAt"
+	}
+	if query.Descending {
+		return q.Order("-" + order)
+	}
+	return q.Order(order)
+}
+
+// ListUsers function
+func (s *Store) ListUsers(ctx context.Context, query store.UserQuery) (store.UserPage, error) {
+	var page store.UserPage
+	q, err := paginate(userQuery(query), query.Start, query.Offset, query.Limit)
+	if err != nil {
+		return page, err
+	}
+	page.End, page.More, err = readPage(s.client.Run(ctx, q), query.Limit, func(it *datastore.Iterator, keep bool) error {
+		if !keep {
+			_, err := it.Next(nil)
+			return err
+		}
+		var user m.User
+		key, err := it.Next(&user)
+		if err != nil {
+			return err
+		}
+		user.ID = formatID(key)
+		page.Users = append(page.Users, user)
+		return nil
+	})
+	return page, err
+}
+
+// CountUsers function
+func (s *Store) CountUsers(ctx context.Context, query store.UserQuery) (int, error) {
+	return s.client.Count(ctx, userQuery(query).KeysOnly())
+}
+
+// Posts use the key layout of the aedatastore backend, which shares their
+// entities: they are stored under the key of their author with an ID allocated
+// from the root Post path, and a PostOwner entity with the same ID records the
+// author. Posts stored before this layout live at the root until MigratePostKeys moves them.
+
+// postOwner records the author of a post
+type postOwner struct {
+	UserID string
+}
+
+// postKey returns the key of a post under its author
+func postKey(userID string, intID int64) (*datastore.Key, error) {
+	userIntID, err := parseID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return datastore.IDKey("Post", intID, datastore.IDKey("User", userIntID, nil)), nil
+}
+
+// ownerKey returns the key of the PostOwner of a post
+func ownerKey(intID int64) *datastore.Key {
+	return datastore.IDKey("PostOwner", intID, nil)
+}
+
+// rootPostKey returns the key a post had before it was stored under its author
+func rootPostKey(intID int64) *datastore.Key {
+	return datastore.IDKey("Post", intID, nil)
+}
+
+// lookupPostKeys returns the keys of the posts with the given IDs, at the root for posts that were not migrated yet
+func (s *Store) lookupPostKeys(ctx context.Context, intIDs []int64) ([]*datastore.Key, error) {
+	ownerKeys := make([]*datastore.Key, len(intIDs))
+	for i, intID := range intIDs {
+		ownerKeys[i] = ownerKey(intID)
+	}
+	owners := make([]postOwner, len(intIDs))
+	var err error
+	if tx := transaction(ctx); tx != nil {
+		err = tx.GetMulti(ownerKeys, owners)
+	} else {
+		err = s.client.GetMulti(ctx, ownerKeys, owners)
+	}
+	multiErr, _ := err.(datastore.MultiError)
+	if err != nil && multiErr == nil {
+		return nil, err
+	}
+	keys := make([]*datastore.Key, len(intIDs))
+	for i, intID := range intIDs {
+		if multiErr != nil && multiErr[i] != nil {
+			if multiErr[i] != datastore.ErrNoSuchEntity {
+				return nil, multiErr[i]
+			}
+			keys[i] = rootPostKey(intID)
+			continue
+		}
+		if keys[i], err = postKey(owners[i].UserID, intID); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// GetPost function
+func (s *Store) GetPost(ctx context.Context, id string) (*m.Post, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.lookupPostKeys(ctx, []int64{intID})
+	if err != nil {
+		return nil, err
+	}
+	post := &m.Post{}
+	if err := s.get(ctx, keys[0], post); err != nil {
+		return nil, err
+	}
+	post.ID = id
+	return post, nil
+}
+
+// PutPost function writes the post and its owner in one call, which is only
+// atomic inside a transaction. A post of the root layout is moved under its author.
+func (s *Store) PutPost(ctx context.Context, post *m.Post) error {
+	var intID int64
+	if post.ID == "" {
+		keys, err := s.client.AllocateIDs(ctx, []*datastore.Key{datastore.IncompleteKey("Post", nil)})
+		if err != nil {
+			return err
+		}
+		intID = keys[0].ID
+	} else {
+		var err error
+		if intID, err = parseID(post.ID); err != nil {
+			return err
+		}
+	}
+	key, err := postKey(post.UserID, intID)
+	if err != nil {
+		return err
+	}
+	keys := []*datastore.Key{key, ownerKey(intID)}
+	src := []interface{}{post, &postOwner{UserID: post.UserID}}
+	if tx := transaction(ctx); tx != nil {
+		_, err = tx.PutMulti(keys, src)
+	} else {
+		_, err = s.client.PutMulti(ctx, keys, src)
+	}
+	if err != nil {
+		return err
+	}
+	if post.ID != "" {
+		if err := s.deleteKeys(ctx, []*datastore.Key{rootPostKey(intID)}); err != nil {
+			return err
+		}
+	}
+	post.ID = strconv.FormatInt(intID, 10)
+	return nil
+}
+
+// maxKeysPerCall is the largest number of keys the datastore accepts in one batch call
+const maxKeysPerCall = 500
+
+// deleteKeys removes the entities at keys, inside the transaction of ctx when there is one,
+// in as many calls as the datastore limit requires
+func (s *Store) deleteKeys(ctx context.Context, keys []*datastore.Key) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxKeysPerCall {
+			n = maxKeysPerCall
+		}
+		var err error
+		if tx := transaction(ctx); tx != nil {
+			err = tx.DeleteMulti(keys[:n])
+		} else {
+			err = s.client.DeleteMulti(ctx, keys[:n])
+		}
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// DeletePost function
+func (s *Store) DeletePost(ctx context.Context, id string) error {
+	return s.DeletePosts(ctx, []string{id})
+}
+
+// DeletePosts function
+func (s *Store) DeletePosts(ctx context.Context, ids []string) error {
+	intIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return err
+		}
+		intIDs[i] = intID
+	}
+	keys, err := s.lookupPostKeys(ctx, intIDs)
+	if err != nil {
+		return err
+	}
+	for _, intID := range intIDs {
+		keys = append(keys, ownerKey(intID))
+	}
+	return s.deleteKeys(ctx, keys)
+}
+
+// postQuery builds the datastore query shared by ListPosts and CountPosts
+func postQuery(query store.PostQuery) (*datastore.Query, error) {
+	q := datastore.NewQuery("Post")
+	if query.UserID != "" {
+		userIntID, err := parseID(query.UserID)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Ancestor(datastore.IDKey("User", userIntID, nil))
+	}
+	if !query.CreatedAfter.IsZero() {
+		q = q.Filter("CreatedAt >", query.CreatedAfter)
+	}
+	if !query.CreatedBefore.IsZero() {
+		q = q.Filter("CreatedAt <", query.CreatedBefore)
+	}
+	if !query.UpdatedAfter.IsZero() {
+		q = q.Filter("UpdatedAt >", query.UpdatedAfter)
+	}
+	if !query.UpdatedBefore.IsZero() {
+		q = q.Filter("UpdatedAt <", query.UpdatedBefore)
+	}
+	order := "CreatedAt"
+	if query.OrderBy == store.PostOrderUpdatedAt {
+		order = "UpdatedAt" // posts stored before edits were recorded have no UpdatedAt, and are left out
+	}
+	if query.Descending {
+		return q.Order("-" + order), nil
+	}
+	return q.Order(order), nil
+}
+
+// ListPosts function
+func (s *Store) ListPosts(ctx context.Context, query store.PostQuery) (store.PostPage, error) {
+	var page store.PostPage
+	q, err := postQuery(query)
+	if err != nil {
+		return page, err
+	}
+	q, outside, err := postBounds(q, query)
+	if err != nil {
+		return page, err
+	}
+	limit, offset := query.Limit, 0
+	if outside != nil { // the posts left out count towards neither the offset nor the limit
+		offset, query.Offset, query.Limit = query.Offset, 0, -1
+	}
+	q, err = paginate(q, query.Start, query.Offset, query.Limit)
+	if err != nil {
+		return page, err
+	}
+	page.End, page.More, err = readPage(s.client.Run(ctx, q), limit, func(it *datastore.Iterator, keep bool) error {
+		var post m.Post
+		key, err := it.Next(&post)
+		if err != nil {
+			return err
+		}
+		if outside != nil && outside(key, post) {
+			return errSkipped
+		}
+		if offset > 0 {
+			offset--
+			return errSkipped
+		}
+		if keep {
+			post.ID = formatID(key)
+			page.Posts = append(page.Posts, post)
+		}
+		return nil
+	})
+	return page, translateError(err)
+}
+
+// postBounds applies the After and Before positions of query to q. Queries cannot
+// compare the IDs of the posts tied with a position, so q takes those posts in and
+// outside reports the ones to leave out as they are read, outside is nil when there
+// are no positions.
+func postBounds(q *datastore.Query, query store.PostQuery) (*datastore.Query, func(key *datastore.Key, post m.Post) bool, error) {
+	if query.After == nil && query.Before == nil {
+		return q, nil, nil
+	}
+	property := "CreatedAt"
+	if query.OrderBy == store.PostOrderUpdatedAt {
+		property = "UpdatedAt"
+	}
+	var afterID, beforeID int64
+	var err error
+	if query.After != nil {
+		if afterID, err = parseID(query.After.ID); err != nil {
+			return nil, nil, store.ErrInvalidQuery
+		}
+		q = q.Filter(property+" >=", query.After.SortKey)
+	}
+	if query.Before != nil {
+		if beforeID, err = parseID(query.Before.ID); err != nil {
+			return nil, nil, store.ErrInvalidQuery
+		}
+		q = q.Filter(property+" <=", query.Before.SortKey)
+	}
+	return q, func(key *datastore.Key, post m.Post) bool {
+		sortKey := post.CreatedAt
+		if query.OrderBy == store.PostOrderUpdatedAt {
+			sortKey = post.UpdatedAt
+		}
+		return query.After != nil && sortKey.Equal(query.After.SortKey) && key.ID <= afterID ||
+			query.Before != nil && sortKey.Equal(query.Before.SortKey) && key.ID >= beforeID
+	}, nil
+}
+
+// CountPosts function
+func (s *Store) CountPosts(ctx context.Context, query store.PostQuery) (int, error) {
+	q, err := postQuery(query)
+	if err != nil {
+		return 0, err
+	}
+	count, err := s.client.Count(ctx, q.KeysOnly())
+	return count, translateError(err)
+}
+
+// MigratePostKeys moves up to limit posts of the root layout under their
+// author, keeping their IDs. It returns the cursor to resume from and whether
+// every post was visited, posts whose UserID is malformed stay where they are.
+func (s *Store) MigratePostKeys(ctx context.Context, start string, limit int) (string, bool, error) {
+	q, err := paginate(datastore.NewQuery("Post").KeysOnly(), start, 0, limit)
+	if err != nil {
+		return "", false, err
+	}
+	var rootKeys []*datastore.Key
+	end, more, err := readPage(s.client.Run(ctx, q), limit, func(it *datastore.Iterator, keep bool) error {
+		key, err := it.Next(nil)
+		if err != nil {
+			return err
+		}
+		if keep && key.Parent == nil {
+			rootKeys = append(rootKeys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	for _, rootKey := range rootKeys {
+		err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+			var post m.Post
+			if err := s.get(ctx, rootKey, &post); err == store.ErrNotFound {
+				return nil // already moved, the query is eventually consistent
+			} else if err != nil {
+				return err
+			}
+			post.ID = formatID(rootKey)
+			return s.PutPost(ctx, &post) // also deletes the root entity
+		})
+		if err != nil && err != store.ErrInvalidID {
+			return "", false, err
+		}
+	}
+	return end, !more, nil
+}
+
+// paginate applies a start cursor, offset and limit to q, fetching one extra
+// entity to learn whether another page follows
+func paginate(q *datastore.Query, start string, offset, limit int) (*datastore.Query, error) {
+	if start != "" {
+		cursor, err := datastore.DecodeCursor(start)
+		if err != nil {
+			return nil, store.ErrInvalidQuery
+		}
+		q = q.Start(cursor)
+	}
+	if offset > 0 {
+		q = q.Offset(offset)
+	}
+	if limit >= 0 {
+		q = q.Limit(limit + 1)
+	}
+	return q, nil
+}
+
+// errSkipped is returned by the load function of readPage for the entities it leaves out
+var errSkipped = errors.New("clouddatastore: entity left out")
+
+// readPage calls load for up to limit entities of it and returns the cursor
+// after the last one loaded, along with whether more entities follow. The
+// entities load skips count for neither, and load keeps nothing of the entity
+// readPage probes for once the page is full.
+func readPage(it *datastore.Iterator, limit int, load func(it *datastore.Iterator, keep bool) error) (string, bool, error) {
+	for loaded := 0; ; {
+		if loaded == limit {
+			cursor, err := it.Cursor() // taken before probing for the extra entity
+			if err != nil {
+				return "", false, err
+			}
+			end := cursor.String()
+			err = load(it, false)
+			for err == errSkipped {
+				err = load(it, false)
+			}
+			if err == iterator.Done {
+				return end, false, nil
+			} else if err != nil {
+				return "", false, err
+			}
+			return end, true, nil
+		}
+		err := load(it, true)
+		if err == iterator.Done {
+			break
+		}
+		if err == errSkipped {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		loaded++
+	}
+	cursor, err := it.Cursor()
+	if err != nil {
+		return "", false, err
+	}
+	return cursor.String(), false, nil
+}
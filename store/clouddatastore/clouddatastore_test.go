@@ -0,0 +1,42 @@
+//go:build clouddatastore
+// +build clouddatastore
+
+package clouddatastore
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/storetest"
+)
+
+// TestStore runs against the emulator at DATASTORE_EMULATOR_HOST, started with
+//
+//	gcloud beta emulators datastore start --no-store-on-disk --consistency=1.0
+//
+// so that queries outside of an entity group see the writes right away
+func TestStore(t *testing.T) {
+	host := os.Getenv("DATASTORE_EMULATOR_HOST")
+	if host == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST is not set")
+	}
+	s, err := New(context.Background(), "storetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	storetest.Run(t, func(t *testing.T) store.Store {
+		resp, err := http.Post("http://"+host+"/reset", "text/plain", nil) // every test starts from an empty datastore
+		if err != nil {
+			t.Fatalf("resetting the emulator: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("resetting the emulator: %s", resp.Status)
+		}
+		return s
+	})
+}
@@ -0,0 +1,416 @@
+package memstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+)
+
+// errNestedTransaction mirrors the datastore, which cannot nest transactions
+var errNestedTransaction = errors.New("memstore: nested transactions are not supported")
+
+// Store implements store.Store in memory, for local development and tests
+type Store struct {
+	mu     sync.Mutex // held for the whole of a transaction, or a single operation
+	nextID int64
+	users  map[int64]m.User
+	posts  map[int64]m.Post
+}
+
+// New function
+func New() *Store {
+	return &Store{
+		users: map[int64]m.User{},
+		posts: map[int64]m.Post{},
+	}
+}
+
+type txKey struct{}
+
+// lock acquires the store unless ctx belongs to one of its transactions
+func (s *Store) lock(ctx context.Context) func() {
+	if tx, _ := ctx.Value(txKey{}).(*Store); tx == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// RunInTransaction runs fn while holding the store, rolling back its writes when it fails
+func (s *Store) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, _ := ctx.Value(txKey{}).(*Store); tx == s {
+		return errNestedTransaction
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make(map[int64]m.User, len(s.users)) // snapshot for the rollback
+	for id, user := range s.users {
+		users[id] = user
+	}
+	posts := make(map[int64]m.Post, len(s.posts))
+	for id, post := range s.posts {
+		posts[id] = post
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, s)); err != nil {
+		s.users, s.posts = users, posts
+		return err
+	}
+	return nil
+}
+
+// parseID converts a public ID into an integer ID, matching the datastore backend
+func parseID(id string) (int64, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || intID <= 0 {
+		return 0, store.ErrInvalidID
+	}
+	return intID, nil
+}
+
+// assignID returns the integer ID for an entity, allocating one when id is empty
+func (s *Store) assignID(id string) (int64, error) {
+	if id == "" {
+		s.nextID++
+		return s.nextID, nil
+	}
+	intID, err := parseID(id)
+	if err != nil {
+		return 0, err
+	}
+	if intID > s.nextID {
+		s.nextID = intID
+	}
+	return intID, nil
+}
+
+// GetUser function
+func (s *Store) GetUser(ctx context.Context, id string) (*m.User, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.lock(ctx)()
+	user, ok := s.users[intID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &user, nil
+}
+
+// GetUsers function
+func (s *Store) GetUsers(ctx context.Context, ids []string) ([]*m.User, error) {
+	intIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return nil, err
+		}
+		intIDs[i] = intID
+	}
+	defer s.lock(ctx)()
+	result := make([]*m.User, len(ids))
+	for i, intID := range intIDs {
+		if user, ok := s.users[intID]; ok {
+			result[i] = &user
+		}
+	}
+	return result, nil
+}
+
+// PutUser function
+func (s *Store) PutUser(ctx context.Context, user *m.User) error {
+	defer s.lock(ctx)()
+	intID, err := s.assignID(user.ID)
+	if err != nil {
+		return err
+	}
+	user.ID = strconv.FormatInt(intID, 10)
+	s.users[intID] = *user
+	return nil
+}
+
+// DeleteUser function
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	intID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+	delete(s.users, intID)
+	return nil
+}
+
+// matchUser reports whether user satisfies the filters of query
+func matchUser(user m.User, query store.UserQuery) bool {
+	if !strings.HasPrefix(user.Name, query.NamePrefix) {
+		return false
+	}
+	if query.NameAfter != "" && user.Name <= query.NameAfter {
+		return false
+	}
+	if query.NameBefore != "" && user.Name >= query.NameBefore {
+		return false
+	}
+	if !query.CreatedAfter.IsZero() && !user.CreatedAt.After(query.CreatedAfter) {
+		return false
+	}
+	if !query.CreatedBefore.IsZero() && !user.CreatedAt.Before(query.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// ListUsers function
+func (s *Store) ListUsers(ctx context.Context, query store.UserQuery) (store.UserPage, error) {
+	var page store.UserPage
+	defer s.lock(ctx)()
+	var positions []position
+	for id, user := range s.users {
+		if !matchUser(user, query) {
+			continue
+		}
+		if query.OrderBy == store.UserOrderCreatedAt {
+			positions = append(positions, position{CreatedAt: user.CreatedAt, ID: id})
+		} else {
+			positions = append(positions, position{Name: user.Name, ID: id})
+		}
+	}
+	positions, end, more, err := paginate(positions, query.Descending, query.Start, query.Offset, query.Limit)
+	if err != nil {
+		return page, err
+	}
+	for _, p := range positions {
+		page.Users = append(page.Users, s.users[p.ID])
+	}
+	page.End, page.More = end, more
+	return page, nil
+}
+
+// CountUsers function
+func (s *Store) CountUsers(ctx context.Context, query store.UserQuery) (int, error) {
+	defer s.lock(ctx)()
+	count := 0
+	for _, user := range s.users {
+		if matchUser(user, query) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetPost function
+func (s *Store) GetPost(ctx context.Context, id string) (*m.Post, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.lock(ctx)()
+	post, ok := s.posts[intID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &post, nil
+}
+
+// PutPost function
+func (s *Store) PutPost(ctx context.Context, post *m.Post) error {
+	defer s.lock(ctx)()
+	intID, err := s.assignID(post.ID)
+	if err != nil {
+		return err
+	}
+	post.ID = strconv.FormatInt(intID, 10)
+	s.posts[intID] = *post
+	return nil
+}
+
+// DeletePost function
+func (s *Store) DeletePost(ctx context.Context, id string) error {
+	intID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	defer s.lock(ctx)()
+	delete(s.posts, intID)
+	return nil
+}
+
+// DeletePosts function
+func (s *Store) DeletePosts(ctx context.Context, ids []string) error {
+	intIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return err
+		}
+		intIDs[i] = intID
+	}
+	defer s.lock(ctx)()
+	for _, intID := range intIDs {
+		delete(s.posts, intID)
+	}
+	return nil
+}
+
+// matchPost reports whether post satisfies the filters of query
+func matchPost(post m.Post, query store.PostQuery) bool {
+	if query.UserID != "" && post.UserID != query.UserID {
+		return false
+	}
+	if !query.CreatedAfter.IsZero() && !post.CreatedAt.After(query.CreatedAfter) {
+		return false
+	}
+	if !query.CreatedBefore.IsZero() && !post.CreatedAt.Before(query.CreatedBefore) {
+		return false
+	}
+	if !query.UpdatedAfter.IsZero() && !post.UpdatedAt.After(query.UpdatedAfter) {
+		return false
+	}
+	if !query.UpdatedBefore.IsZero() && !post.UpdatedAt.Before(query.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// ListPosts function
+func (s *Store) ListPosts(ctx context.Context, query store.PostQuery) (store.PostPage, error) {
+	var page store.PostPage
+	after, err := boundPosition(query.After)
+	if err != nil {
+		return page, err
+	}
+	before, err := boundPosition(query.Before)
+	if err != nil {
+		return page, err
+	}
+	defer s.lock(ctx)()
+	var positions []position
+	for id, post := range s.posts {
+		if !matchPost(post, query) {
+			continue
+		}
+		p := position{CreatedAt: post.CreatedAt, ID: id}
+		if query.OrderBy == store.PostOrderUpdatedAt {
+			p.CreatedAt = post.UpdatedAt
+		}
+		if after != nil && !after.less(p) || before != nil && !p.less(*before) {
+			continue
+		}
+		positions = append(positions, p)
+	}
+	positions, end, more, err := paginate(positions, query.Descending, query.Start, query.Offset, query.Limit)
+	if err != nil {
+		return page, err
+	}
+	for _, p := range positions {
+		page.Posts = append(page.Posts, s.posts[p.ID])
+	}
+	page.End, page.More = end, more
+	return page, nil
+}
+
+// CountPosts function
+func (s *Store) CountPosts(ctx context.Context, query store.PostQuery) (int, error) {
+	defer s.lock(ctx)()
+	count := 0
+	for _, post := range s.posts {
+		if matchPost(post, query) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// position is the sort key of an entity, it doubles as a cursor
+type position struct {
+	Name      string    `json:"n,omitempty"`
+	CreatedAt time.Time `json:"t"` // or UpdatedAt, for posts ordered by it
+	ID        int64     `json:"i"`
+}
+
+// less orders positions by name, then creation time, then ID
+func (p position) less(other position) bool {
+	if p.Name != other.Name {
+		return p.Name < other.Name
+	}
+	if !p.CreatedAt.Equal(other.CreatedAt) {
+		return p.CreatedAt.Before(other.CreatedAt)
+	}
+	return p.ID < other.ID
+}
+
+// boundPosition returns the position of a post bounding a query, nil when there is none
+func boundPosition(bound *store.PostPosition) (*position, error) {
+	if bound == nil {
+		return nil, nil
+	}
+	intID, err := parseID(bound.ID)
+	if err != nil {
+		return nil, store.ErrInvalidQuery
+	}
+	return &position{CreatedAt: bound.SortKey, ID: intID}, nil
+}
+
+// encode function
+func (p position) encode() string {
+	raw, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodePosition function
+func decodePosition(s string) (position, error) {
+	var p position
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return p, store.ErrInvalidQuery
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return p, store.ErrInvalidQuery
+	}
+	return p, nil
+}
+
+// paginate sorts positions and cuts out the requested page
+func paginate(positions []position, descending bool, start string, offset, limit int) ([]position, string, bool, error) {
+	sort.Slice(positions, func(i, j int) bool {
+		if descending {
+			return positions[j].less(positions[i])
+		}
+		return positions[i].less(positions[j])
+	})
+	if start != "" {
+		after, err := decodePosition(start)
+		if err != nil {
+			return nil, "", false, err
+		}
+		i := 0
+		for i < len(positions) && !(descending && positions[i].less(after) || !descending && after.less(positions[i])) {
+			i++
+		}
+		positions = positions[i:]
+	}
+	if offset > len(positions) {
+		offset = len(positions)
+	}
+	positions = positions[offset:]
+	more := false
+	if limit >= 0 && len(positions) > limit {
+		positions, more = positions[:limit], true
+	}
+	end := start
+	if len(positions) > 0 {
+		end = positions[len(positions)-1].encode()
+	}
+	return positions, end, more, nil
+}
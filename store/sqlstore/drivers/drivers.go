@@ -0,0 +1,3 @@
+// Package drivers registers the database/sql drivers selected with build tags:
+// `postgres` registers github.com/lib/pq and `sqlite` registers github.com/mattn/go-sqlite3.
+package drivers
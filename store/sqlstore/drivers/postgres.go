@@ -0,0 +1,8 @@
+//go:build postgres
+// +build postgres
+
+package drivers
+
+import (
+	_ "github.com/lib/pq" // registers the "postgres" driver
+)
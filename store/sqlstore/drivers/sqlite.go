@@ -0,0 +1,8 @@
+//go:build sqlite
+// +build sqlite
+
+package drivers
+
+import (
+	_ "github.com/mattn/go-sqlite3" // registers the "sqlite3" driver
+)
@@ -0,0 +1,112 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFile matches migration file names such as `0001_create_users_and_posts.sql`
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// LoadMigrations reads the migration files of dir, ordered by version
+func LoadMigrations(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	seen := map[int]string{}
+	for _, file := range files {
+		match := migrationFile.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("sqlstore: migrations %s and %s share version %d", other, file.Name(), version)
+		}
+		seen[version] = file.Name()
+		body, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: match[2], SQL: string(body)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationsDir returns the directory holding the migrations of dialect, relative to root
+func MigrationsDir(root string, dialect Dialect) string {
+	return filepath.Join(root, string(dialect))
+}
+
+// createMigrationsTable records which migrations were applied
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// AppliedVersions returns the versions already applied to db
+func AppliedVersions(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies, each in its own transaction, the migrations not yet applied to db and returns them
+func Migrate(ctx context.Context, db *sql.DB, dialect Dialect, migrations []Migration) ([]Migration, error) {
+	applied, err := AppliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	s := New(db, dialect)
+	var done []Migration
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+			if _, err := s.conn(ctx).ExecContext(ctx, migration.SQL); err != nil {
+				return err
+			}
+			_, err := s.conn(ctx).ExecContext(ctx, s.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+				migration.Version, migration.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("sqlstore: migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
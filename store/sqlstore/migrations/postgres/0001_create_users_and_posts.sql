@@ -0,0 +1,16 @@
+CREATE TABLE users (
+	id   BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE INDEX users_name ON users (name, id);
+
+CREATE TABLE posts (
+	id         BIGSERIAL PRIMARY KEY,
+	user_id    BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	content    TEXT NOT NULL
+);
+
+CREATE INDEX posts_created_at ON posts (created_at, id);
+CREATE INDEX posts_user_id_created_at ON posts (user_id, created_at, id);
@@ -0,0 +1,2 @@
+-- posts created before this migration were never edited
+ALTER TABLE posts ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00';
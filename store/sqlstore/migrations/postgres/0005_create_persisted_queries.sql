@@ -0,0 +1,10 @@
+-- queries persisted by clients, and operations of the manifests registered for the allowlist, by SHA-256 hash
+CREATE TABLE persisted_queries (
+	hash  TEXT PRIMARY KEY,
+	query TEXT NOT NULL
+);
+
+CREATE TABLE allowed_queries (
+	hash  TEXT PRIMARY KEY,
+	query TEXT NOT NULL
+);
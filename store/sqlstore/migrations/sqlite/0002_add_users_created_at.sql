@@ -0,0 +1,4 @@
+-- users created before this migration have no known creation time
+ALTER TABLE users ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT '0001-01-01 00:00:00';
+
+CREATE INDEX users_created_at ON users (created_at, id);
@@ -0,0 +1,3 @@
+-- posts listed by their last edit
+CREATE INDEX posts_updated_at ON posts (updated_at, id);
+CREATE INDEX posts_user_id_updated_at ON posts (user_id, updated_at, id);
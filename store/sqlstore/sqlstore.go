@@ -0,0 +1,578 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+)
+
+// Dialect captures the differences between the supported SQL databases
+type Dialect string
+
+// Supported dialects
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// DialectForDriver returns the dialect spoken by a database/sql driver
+func DialectForDriver(driver string) (Dialect, error) {
+	switch driver {
+	case "postgres", "pgx":
+		return Postgres, nil
+	case "sqlite3", "sqlite":
+		return SQLite, nil
+	default:
+		return "", fmt.Errorf("sqlstore: unsupported driver %q", driver)
+	}
+}
+
+// errNestedTransaction is returned when a transaction is started inside another one
+var errNestedTransaction = errors.New("sqlstore: nested transactions are not supported")
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Store implements store.Store on a SQL database, the schema is created by Migrate
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// New function
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{db: db, dialect: dialect}
+}
+
+type txKey struct{}
+
+// conn returns the transaction ctx belongs to, or the database
+func (s *Store) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.db
+}
+
+// RunInTransaction function
+func (s *Store) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return errNestedTransaction
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebind rewrites `?` placeholders into the syntax of the dialect
+func (s *Store) rebind(query string) string {
+	return s.dialect.Rebind(query)
+}
+
+// Rebind rewrites `?` placeholders into the syntax of the dialect
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// parseID converts a public ID into an integer ID, matching the datastore backends
+func parseID(id string) (int64, error) {
+	intID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || intID <= 0 {
+		return 0, store.ErrInvalidID
+	}
+	return intID, nil
+}
+
+// formatID converts an integer ID into a public ID
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// insertOrUpdate inserts a row, or overwrites the row with the given id when it is not empty, and returns its id
+func (s *Store) insertOrUpdate(ctx context.Context, table, id string, columns []string, values []interface{}) (string, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	if id == "" && s.dialect == SQLite { // the SQLite bundled with go-sqlite3 predates RETURNING
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders)
+		result, err := s.conn(ctx).ExecContext(ctx, query, values...)
+		if err != nil {
+			return "", err
+		}
+		intID, err := result.LastInsertId()
+		if err != nil {
+			return "", err
+		}
+		return formatID(intID), nil
+	}
+	if id == "" {
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING id", table, strings.Join(columns, ", "), placeholders)
+		var intID int64
+		if err := s.conn(ctx).QueryRowContext(ctx, s.rebind(query), values...).Scan(&intID); err != nil {
+			return "", err
+		}
+		return formatID(intID), nil
+	}
+
+	intID, err := parseID(id)
+	if err != nil {
+		return "", err
+	}
+	updates := make([]string, len(columns))
+	for i, column := range columns {
+		updates[i] = column + " = excluded." + column
+	}
+	query := fmt.Sprintf("INSERT INTO %s (id, %s) VALUES (?, %s) ON CONFLICT (id) DO UPDATE SET %s",
+		table, strings.Join(columns, ", "), placeholders, strings.Join(updates, ", "))
+	if _, err := s.conn(ctx).ExecContext(ctx, s.rebind(query), append([]interface{}{intID}, values...)...); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// deleteRow removes the row of table with the given id
+func (s *Store) deleteRow(ctx context.Context, table, id string) error {
+	intID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn(ctx).ExecContext(ctx, s.rebind("DELETE FROM "+table+" WHERE id = ?"), intID)
+	return err
+}
+
+// GetUser function
+func (s *Store) GetUser(ctx context.Context, id string) (*m.User, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	user := &m.User{ID: id}
+	err = s.conn(ctx).QueryRowContext(ctx, s.rebind("SELECT name, created_at FROM users WHERE id = ?"), intID).Scan(&user.Name, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	return user, nil
+}
+
+// GetUsers function
+func (s *Store) GetUsers(ctx context.Context, ids []string) ([]*m.User, error) {
+	result := make([]*m.User, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = intID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	rows, err := s.conn(ctx).QueryContext(ctx, s.rebind("SELECT id, name, created_at FROM users WHERE id IN ("+placeholders+")"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := map[string]*m.User{}
+	for rows.Next() {
+		var intID int64
+		user := &m.User{}
+		if err := rows.Scan(&intID, &user.Name, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		user.ID, user.CreatedAt = formatID(intID), user.CreatedAt.UTC()
+		found[user.ID] = user
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if user, ok := found[id]; ok {
+			copied := *user
+			result[i] = &copied
+		}
+	}
+	return result, nil
+}
+
+// PutUser function
+func (s *Store) PutUser(ctx context.Context, user *m.User) error {
+	id, err := s.insertOrUpdate(ctx, "users", user.ID, []string{"name", "created_at"}, []interface{}{user.Name, user.CreatedAt.UTC()})
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+// DeleteUser function
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	return s.deleteRow(ctx, "users", id)
+}
+
+// userConditions translates the filters of query into a WHERE clause
+func userConditions(query store.UserQuery) *conditions {
+	where := newConditions()
+	if query.NamePrefix != "" {
+		where.add("name >= ? AND name < ?", query.NamePrefix, store.PrefixEnd(query.NamePrefix)) // a range the users_name index serves
+	}
+	if query.NameAfter != "" {
+		where.add("name > ?", query.NameAfter)
+	}
+	if query.NameBefore != "" {
+		where.add("name < ?", query.NameBefore)
+	}
+	if !query.CreatedAfter.IsZero() {
+		where.add("created_at > ?", query.CreatedAfter.UTC())
+	}
+	if !query.CreatedBefore.IsZero() {
+		where.add("created_at < ?", query.CreatedBefore.UTC())
+	}
+	return where
+}
+
+// ListUsers function
+func (s *Store) ListUsers(ctx context.Context, query store.UserQuery) (store.UserPage, error) {
+	var page store.UserPage
+	where := userConditions(query)
+	column := "name"
+	if query.OrderBy == store.UserOrderCreatedAt {
+		column = "created_at"
+	}
+	if query.Start != "" {
+		after, err := decodePosition(query.Start)
+		if err != nil {
+			return page, err
+		}
+		if query.OrderBy == store.UserOrderCreatedAt {
+			where.after(column, after.CreatedAt.UTC(), after.ID, query.Descending)
+		} else {
+			where.after(column, after.Name, after.ID, query.Descending)
+		}
+	}
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		s.rebind("SELECT id, name, created_at FROM users"+where.sql()+orderBy(column, query.Descending)+s.limit(query.Offset, query.Limit)),
+		where.args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var intID int64
+		var user m.User
+		if err := rows.Scan(&intID, &user.Name, &user.CreatedAt); err != nil {
+			return page, err
+		}
+		user.ID, user.CreatedAt = formatID(intID), user.CreatedAt.UTC()
+		page.Users = append(page.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if query.Limit >= 0 && len(page.Users) > query.Limit {
+		page.Users, page.More = page.Users[:query.Limit], true
+	}
+	page.End = query.Start
+	if n := len(page.Users); n > 0 {
+		last := page.Users[n-1]
+		intID, _ := parseID(last.ID)
+		if query.OrderBy == store.UserOrderCreatedAt {
+			page.End = position{CreatedAt: last.CreatedAt, ID: intID}.encode()
+		} else {
+			page.End = position{Name: last.Name, ID: intID}.encode()
+		}
+	}
+	return page, nil
+}
+
+// CountUsers function
+func (s *Store) CountUsers(ctx context.Context, query store.UserQuery) (int, error) {
+	where := userConditions(query)
+	var count int
+	err := s.conn(ctx).QueryRowContext(ctx, s.rebind("SELECT COUNT(*) FROM users"+where.sql()), where.args...).Scan(&count)
+	return count, err
+}
+
+// GetPost function
+func (s *Store) GetPost(ctx context.Context, id string) (*m.Post, error) {
+	intID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	post := &m.Post{ID: id}
+	var userID int64
+	err = s.conn(ctx).QueryRowContext(ctx, s.rebind("SELECT user_id, created_at, updated_at, content FROM posts WHERE id = ?"), intID).
+		Scan(&userID, &post.CreatedAt, &post.UpdatedAt, &post.Content)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	post.UserID = formatID(userID)
+	post.CreatedAt, post.UpdatedAt = post.CreatedAt.UTC(), post.UpdatedAt.UTC()
+	return post, nil
+}
+
+// PutPost function
+func (s *Store) PutPost(ctx context.Context, post *m.Post) error {
+	userID, err := parseID(post.UserID)
+	if err != nil {
+		return err
+	}
+	id, err := s.insertOrUpdate(ctx, "posts", post.ID, []string{"user_id", "created_at", "updated_at", "content"},
+		[]interface{}{userID, post.CreatedAt.UTC(), post.UpdatedAt.UTC(), post.Content})
+	if err != nil {
+		return err
+	}
+	post.ID = id
+	return nil
+}
+
+// DeletePost function
+func (s *Store) DeletePost(ctx context.Context, id string) error {
+	return s.deleteRow(ctx, "posts", id)
+}
+
+// DeletePosts function
+func (s *Store) DeletePosts(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		intID, err := parseID(id)
+		if err != nil {
+			return err
+		}
+		args[i] = intID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	_, err := s.conn(ctx).ExecContext(ctx, s.rebind("DELETE FROM posts WHERE id IN ("+placeholders+")"), args...)
+	return err
+}
+
+// postConditions translates the filters of query into a WHERE clause
+func postConditions(query store.PostQuery) (*conditions, error) {
+	where := newConditions()
+	if query.UserID != "" {
+		userID, err := parseID(query.UserID)
+		if err != nil {
+			return nil, err
+		}
+		where.add("user_id = ?", userID)
+	}
+	if !query.CreatedAfter.IsZero() {
+		where.add("created_at > ?", query.CreatedAfter.UTC())
+	}
+	if !query.CreatedBefore.IsZero() {
+		where.add("created_at < ?", query.CreatedBefore.UTC())
+	}
+	if !query.UpdatedAfter.IsZero() {
+		where.add("updated_at > ?", query.UpdatedAfter.UTC())
+	}
+	if !query.UpdatedBefore.IsZero() {
+		where.add("updated_at < ?", query.UpdatedBefore.UTC())
+	}
+	return where, nil
+}
+
+// postOrderColumn returns the column posts are ordered by
+func postOrderColumn(order store.PostOrder) string {
+	if order == store.PostOrderUpdatedAt {
+		return "updated_at"
+	}
+	return "created_at"
+}
+
+// ListPosts function
+func (s *Store) ListPosts(ctx context.Context, query store.PostQuery) (store.PostPage, error) {
+	var page store.PostPage
+	where, err := postConditions(query)
+	if err != nil {
+		return page, err
+	}
+	column := postOrderColumn(query.OrderBy)
+	if query.Start != "" {
+		after, err := decodePosition(query.Start)
+		if err != nil {
+			return page, err
+		}
+		where.after(column, after.CreatedAt.UTC(), after.ID, query.Descending)
+	}
+	for _, bound := range []struct {
+		position *store.PostPosition
+		below    bool // whether the rows lie below the position
+	}{{query.After, false}, {query.Before, true}} {
+		if bound.position == nil {
+			continue
+		}
+		intID, err := parseID(bound.position.ID)
+		if err != nil {
+			return page, store.ErrInvalidQuery
+		}
+		where.after(column, bound.position.SortKey.UTC(), intID, bound.below)
+	}
+	rows, err := s.conn(ctx).QueryContext(ctx,
+		s.rebind("SELECT id, user_id, created_at, updated_at, content FROM posts"+where.sql()+orderBy(column, query.Descending)+s.limit(query.Offset, query.Limit)),
+		where.args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var intID, userID int64
+		var post m.Post
+		if err := rows.Scan(&intID, &userID, &post.CreatedAt, &post.UpdatedAt, &post.Content); err != nil {
+			return page, err
+		}
+		post.ID, post.UserID = formatID(intID), formatID(userID)
+		post.CreatedAt, post.UpdatedAt = post.CreatedAt.UTC(), post.UpdatedAt.UTC()
+		page.Posts = append(page.Posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if query.Limit >= 0 && len(page.Posts) > query.Limit {
+		page.Posts, page.More = page.Posts[:query.Limit], true
+	}
+	page.End = query.Start
+	if n := len(page.Posts); n > 0 {
+		last := page.Posts[n-1]
+		intID, _ := parseID(last.ID)
+		end := position{CreatedAt: last.CreatedAt, ID: intID}
+		if query.OrderBy == store.PostOrderUpdatedAt {
+			end.CreatedAt = last.UpdatedAt
+		}
+		page.End = end.encode()
+	}
+	return page, nil
+}
+
+// CountPosts function
+func (s *Store) CountPosts(ctx context.Context, query store.PostQuery) (int, error) {
+	where, err := postConditions(query)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = s.conn(ctx).QueryRowContext(ctx, s.rebind("SELECT COUNT(*) FROM posts"+where.sql()), where.args...).Scan(&count)
+	return count, err
+}
+
+// conditions accumulates the terms of a WHERE clause
+type conditions struct {
+	terms []string
+	args  []interface{}
+}
+
+// newConditions function
+func newConditions() *conditions {
+	return &conditions{}
+}
+
+// add function
+func (c *conditions) add(term string, args ...interface{}) {
+	c.terms = append(c.terms, term)
+	c.args = append(c.args, args...)
+}
+
+// after restricts rows to those sorting after (value, id)
+func (c *conditions) after(column string, value interface{}, id int64, descending bool) {
+	op := ">"
+	if descending {
+		op = "<"
+	}
+	c.add(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, op, column, op), value, value, id)
+}
+
+// sql renders the WHERE clause
+func (c *conditions) sql() string {
+	if len(c.terms) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.terms, " AND ")
+}
+
+// orderBy renders an ORDER BY clause on column, with the id as tie breaker
+func orderBy(column string, descending bool) string {
+	if descending {
+		return " ORDER BY " + column + " DESC, id DESC"
+	}
+	return " ORDER BY " + column + ", id"
+}
+
+// limit renders LIMIT and OFFSET clauses, fetching one extra row to learn whether another page follows
+func (s *Store) limit(offset, limit int) string {
+	clause := ""
+	if limit >= 0 {
+		clause = " LIMIT " + strconv.Itoa(limit+1)
+	} else if offset > 0 && s.dialect == SQLite {
+		clause = " LIMIT -1" // SQLite only accepts OFFSET after a LIMIT
+	}
+	if offset > 0 {
+		clause += " OFFSET " + strconv.Itoa(offset)
+	}
+	return clause
+}
+
+// position is the sort key of a row, it doubles as a cursor
+type position struct {
+	Name      string    `json:"n,omitempty"`
+	CreatedAt time.Time `json:"t"` // or UpdatedAt, for posts ordered by it
+	ID        int64     `json:"i"`
+}
+
+// encode function
+func (p position) encode() string {
+	raw, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodePosition function
+func decodePosition(s string) (position, error) {
+	var p position
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return p, store.ErrInvalidQuery
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return p, store.ErrInvalidQuery
+	}
+	return p, nil
+}
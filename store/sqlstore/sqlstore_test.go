@@ -0,0 +1,49 @@
+//go:build sqlite
+// +build sqlite
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	_ "github.com/damilarelana/goGraphQLGoogleAppEngine/store/sqlstore/drivers" // registers sqlite3
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/storetest"
+)
+
+// openSQLite returns a fresh SQLite database in a temporary directory, with every migration applied
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "graphql.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrations, err := LoadMigrations(MigrationsDir("migrations", SQLite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(context.Background(), db, SQLite, migrations); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store { return New(openSQLite(t), SQLite) })
+}
+
+func TestMigrateTwice(t *testing.T) {
+	db := openSQLite(t)
+	migrations, err := LoadMigrations(MigrationsDir("migrations", SQLite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := Migrate(context.Background(), db, SQLite, migrations)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Migrate of an up to date database applied %v, %v, want nothing", applied, err)
+	}
+}
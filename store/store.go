@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+)
+
+// Errors returned by every Store implementation
+var (
+	ErrNotFound     = errors.New("store: no such entity")
+	ErrInvalidID    = errors.New("store: invalid id")
+	ErrInvalidQuery = errors.New("store: invalid query")
+	ErrNeedIndex    = errors.New("store: no index serves the query")
+)
+
+// MaxBatchSize is the largest number of ids passed to GetUsers or DeletePosts in one call. The
+// datastore backends delete two entities per post, and split their own calls to stay within
+// the datastore limit of 500 keys.
+const MaxBatchSize = 500
+
+// UserOrder is the property users are listed by
+type UserOrder int
+
+// Orders of users, both use the ID as tie breaker
+const (
+	UserOrderName UserOrder = iota
+	UserOrderCreatedAt
+)
+
+// UserQuery describes a page of users. The datastore backends only accept
+// range filters on the property the users are ordered by.
+type UserQuery struct {
+	NamePrefix    string    // only users whose name starts with this prefix, when set
+	NameAfter     string    // exclusive lower bound on Name, when set
+	NameBefore    string    // exclusive upper bound on Name, when set
+	CreatedAfter  time.Time // exclusive lower bound on CreatedAt, when set
+	CreatedBefore time.Time // exclusive upper bound on CreatedAt, when set
+	OrderBy       UserOrder
+	Descending    bool   // order from Z to A, or newest first
+	Start         string // cursor returned by a previous page of the same query
+	Offset        int
+	Limit         int // negative for no limit
+}
+
+// PrefixEnd returns an exclusive upper bound for the strings starting with prefix,
+// which the datastore compares as UTF-8 bytes
+func PrefixEnd(prefix string) string {
+	return prefix + "\U0010FFFF"
+}
+
+// PostOrder is the property posts are listed by
+type PostOrder int
+
+// Orders of posts, both use the ID as tie breaker
+const (
+	PostOrderCreatedAt PostOrder = iota
+	PostOrderUpdatedAt
+)
+
+// PostPosition is the place of a post in the lists, its sort key and its ID
+type PostPosition struct {
+	SortKey time.Time // CreatedAt or UpdatedAt, the property the posts are ordered by
+	ID      string
+}
+
+// PostQuery describes a page of posts. The datastore backends only accept
+// range filters on the property the posts are ordered by.
+type PostQuery struct {
+	UserID        string        // only posts by this user, when set
+	CreatedAfter  time.Time     // exclusive lower bound on CreatedAt, when set
+	CreatedBefore time.Time     // exclusive upper bound on CreatedAt, when set
+	UpdatedAfter  time.Time     // exclusive lower bound on UpdatedAt, when set
+	UpdatedBefore time.Time     // exclusive upper bound on UpdatedAt, when set
+	After         *PostPosition // exclusive lower bound on the sort key and then the ID, when set
+	Before        *PostPosition // exclusive upper bound on the sort key and then the ID, when set
+	OrderBy       PostOrder
+	Descending    bool   // newest first
+	Start         string // cursor returned by a previous page of the same query
+	Offset        int
+	Limit         int // negative for no limit
+}
+
+// UserPage is a page of users
+type UserPage struct {
+	Users []m.User
+	End   string // cursor positioned after the last user
+	More  bool   // whether users follow the last one
+}
+
+// PostPage is a page of posts
+type PostPage struct {
+	Posts []m.Post
+	End   string // cursor positioned after the last post
+	More  bool   // whether posts follow the last one
+}
+
+// UserStore persists users
+type UserStore interface {
+	GetUser(ctx context.Context, id string) (*m.User, error)
+	GetUsers(ctx context.Context, ids []string) ([]*m.User, error) // in the order of ids, nil for missing users
+	PutUser(ctx context.Context, user *m.User) error               // assigns user.ID when it is empty
+	DeleteUser(ctx context.Context, id string) error
+	ListUsers(ctx context.Context, query UserQuery) (UserPage, error)
+	CountUsers(ctx context.Context, query UserQuery) (int, error) // ignores Start, Offset and Limit
+}
+
+// PostStore persists posts
+type PostStore interface {
+	GetPost(ctx context.Context, id string) (*m.Post, error)
+	PutPost(ctx context.Context, post *m.Post) error // assigns post.ID when it is empty
+	DeletePost(ctx context.Context, id string) error
+	DeletePosts(ctx context.Context, ids []string) error // at most MaxBatchSize ids
+	ListPosts(ctx context.Context, query PostQuery) (PostPage, error)
+	CountPosts(ctx context.Context, query PostQuery) (int, error) // ignores After, Before, Start, Offset and Limit
+}
+
+// Store is the persistence used by the resolvers
+type Store interface {
+	UserStore
+	PostStore
+
+	// RunInTransaction runs fn atomically, fn must use the context it is given.
+	// Gets, puts and deletes join the transaction, list and count queries do not.
+	RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying s
+func NewContext(ctx context.Context, s Store) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the Store carried by ctx
+func FromContext(ctx context.Context) Store {
+	s, ok := ctx.Value(contextKey{}).(Store)
+	if !ok {
+		panic("store: no Store in context")
+	}
+	return s
+}
@@ -0,0 +1,529 @@
+// Package storetest checks that an implementation of store.Store behaves like
+// the others, each backend runs it from its own tests.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+)
+
+// base is the creation time of the first entity of a test, the others follow a minute apart
+var base = time.Date(2019, 12, 1, 10, 0, 0, 0, time.UTC)
+
+// errRollback fails a transaction on purpose
+var errRollback = errors.New("storetest: roll back")
+
+// cases are the behaviours every Store shares, each runs against an empty store
+var cases = []struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, s store.Store)
+}{
+	{"UsersRoundTrip", testUsersRoundTrip},
+	{"GetUsersKeepsTheOrderOfIDs", testGetUsers},
+	{"InvalidIDs", testInvalidIDs},
+	{"ListUsersByName", testListUsersByName},
+	{"ListUsersByCreationTime", testListUsersByCreationTime},
+	{"ListUsersPages", testListUsersPages},
+	{"PostsRoundTrip", testPostsRoundTrip},
+	{"ListPostsOfAUser", testListPostsOfAUser},
+	{"ListPostsByUpdateTime", testListPostsByUpdateTime},
+	{"ListPostsPages", testListPostsPages},
+	{"ListPostsFromTiedPositions", testListPostsFromTiedPositions},
+	{"DeletePosts", testDeletePosts},
+	{"DeletePostsFullBatch", testDeletePostsFullBatch},
+	{"TransactionCommits", testTransactionCommits},
+	{"TransactionRollsBack", testTransactionRollsBack},
+}
+
+// Run runs the contract against the stores returned by newStore, which must be empty
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, context.Background(), newStore(t))
+		})
+	}
+}
+
+// putUsers stores a user for each name, created a minute apart
+func putUsers(t *testing.T, ctx context.Context, s store.Store, names ...string) []m.User {
+	t.Helper()
+	users := make([]m.User, len(names))
+	for i, name := range names {
+		user := &m.User{Name: name, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		if err := s.PutUser(ctx, user); err != nil {
+			t.Fatalf("PutUser(%q): %v", name, err)
+		}
+		if user.ID == "" {
+			t.Fatalf("PutUser(%q) assigned no ID", name)
+		}
+		users[i] = *user
+	}
+	return users
+}
+
+// putPosts stores a post of userID for each content, created and updated a minute apart
+func putPosts(t *testing.T, ctx context.Context, s store.Store, userID string, contents ...string) []m.Post {
+	t.Helper()
+	posts := make([]m.Post, len(contents))
+	for i, content := range contents {
+		at := base.Add(time.Duration(i) * time.Minute)
+		post := &m.Post{UserID: userID, Content: content, CreatedAt: at, UpdatedAt: at}
+		if err := s.PutPost(ctx, post); err != nil {
+			t.Fatalf("PutPost(%q): %v", content, err)
+		}
+		if post.ID == "" {
+			t.Fatalf("PutPost(%q) assigned no ID", content)
+		}
+		posts[i] = *post
+	}
+	return posts
+}
+
+// userNames returns the names of users
+func userNames(users []m.User) []string {
+	names := []string{}
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	return names
+}
+
+// postContents returns the content of posts
+func postContents(posts []m.Post) []string {
+	contents := []string{}
+	for _, post := range posts {
+		contents = append(contents, post.Content)
+	}
+	return contents
+}
+
+// missingID returns a well formed ID no entity of the test has
+func missingID(ids ...string) string {
+	max := int64(0)
+	for _, id := range ids {
+		if n, _ := strconv.ParseInt(id, 10, 64); n > max {
+			max = n
+		}
+	}
+	return strconv.FormatInt(max+1000, 10)
+}
+
+func testUsersRoundTrip(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Banner")[0]
+	got, err := s.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.ID != user.ID || got.Name != "Banner" || !got.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("GetUser = %+v, want %+v", *got, user)
+	}
+
+	got.Name = "Bruce"
+	if err := s.PutUser(ctx, got); err != nil {
+		t.Fatalf("PutUser of an existing user: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("PutUser changed the ID from %s to %s", user.ID, got.ID)
+	}
+	if renamed, err := s.GetUser(ctx, user.ID); err != nil || renamed.Name != "Bruce" {
+		t.Errorf("GetUser after rename = %+v, %v, want Bruce", renamed, err)
+	}
+
+	if err := s.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := s.GetUser(ctx, user.ID); err != store.ErrNotFound {
+		t.Errorf("GetUser of a deleted user: %v, want %v", err, store.ErrNotFound)
+	}
+}
+
+func testGetUsers(t *testing.T, ctx context.Context, s store.Store) {
+	users := putUsers(t, ctx, s, "Ann", "Bob")
+	missing := missingID(users[0].ID, users[1].ID)
+	got, err := s.GetUsers(ctx, []string{users[1].ID, missing, users[0].ID})
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(got) != 3 || got[0] == nil || got[0].Name != "Bob" || got[1] != nil || got[2] == nil || got[2].Name != "Ann" {
+		t.Errorf("GetUsers = %v, want [Bob <nil> Ann]", got)
+	}
+	if got, err := s.GetUsers(ctx, nil); err != nil || len(got) != 0 {
+		t.Errorf("GetUsers(nil) = %v, %v, want no users", got, err)
+	}
+}
+
+func testInvalidIDs(t *testing.T, ctx context.Context, s store.Store) {
+	for _, id := range []string{"abc", "0", "-4"} {
+		if _, err := s.GetUser(ctx, id); err != store.ErrInvalidID {
+			t.Errorf("GetUser(%q): %v, want %v", id, err, store.ErrInvalidID)
+		}
+		if _, err := s.GetPost(ctx, id); err != store.ErrInvalidID {
+			t.Errorf("GetPost(%q): %v, want %v", id, err, store.ErrInvalidID)
+		}
+	}
+	if _, err := s.GetUser(ctx, "5629499534213120"); err != store.ErrNotFound {
+		t.Errorf("GetUser of an unknown user: %v, want %v", err, store.ErrNotFound)
+	}
+}
+
+func testListUsersByName(t *testing.T, ctx context.Context, s store.Store) {
+	putUsers(t, ctx, s, "Carl", "Bob", "Ann", "Bea")
+	tests := []struct {
+		query store.UserQuery
+		want  []string
+	}{
+		{store.UserQuery{Limit: -1}, []string{"Ann", "Bea", "Bob", "Carl"}},
+		{store.UserQuery{Descending: true, Limit: -1}, []string{"Carl", "Bob", "Bea", "Ann"}},
+		{store.UserQuery{NamePrefix: "B", Limit: -1}, []string{"Bea", "Bob"}},
+		{store.UserQuery{NamePrefix: "B", Descending: true, Limit: -1}, []string{"Bob", "Bea"}},
+		{store.UserQuery{NamePrefix: "Bo", Limit: -1}, []string{"Bob"}},
+		{store.UserQuery{NamePrefix: "Bob", Limit: -1}, []string{"Bob"}},
+		{store.UserQuery{NameAfter: "Bea", Limit: -1}, []string{"Bob", "Carl"}},
+		{store.UserQuery{NameBefore: "Bob", Limit: -1}, []string{"Ann", "Bea"}},
+		{store.UserQuery{Limit: 2}, []string{"Ann", "Bea"}},
+		{store.UserQuery{Offset: 3, Limit: -1}, []string{"Carl"}},
+		{store.UserQuery{NamePrefix: "Z", Limit: -1}, []string{}},
+	}
+	for _, test := range tests {
+		page, err := s.ListUsers(ctx, test.query)
+		if err != nil {
+			t.Errorf("ListUsers(%+v): %v", test.query, err)
+			continue
+		}
+		if got := userNames(page.Users); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListUsers(%+v) = %v, want %v", test.query, got, test.want)
+		}
+		count, err := s.CountUsers(ctx, test.query)
+		if want := len(test.want); test.query.Limit < 0 && test.query.Offset == 0 && (err != nil || count != want) {
+			t.Errorf("CountUsers(%+v) = %d, %v, want %d", test.query, count, err, want)
+		}
+	}
+	if count, err := s.CountUsers(ctx, store.UserQuery{Limit: 1, Offset: 1}); err != nil || count != 4 {
+		t.Errorf("CountUsers ignoring the page = %d, %v, want 4", count, err)
+	}
+}
+
+func testListUsersByCreationTime(t *testing.T, ctx context.Context, s store.Store) {
+	users := putUsers(t, ctx, s, "Carl", "Ann", "Bob")
+	tests := []struct {
+		query store.UserQuery
+		want  []string
+	}{
+		{store.UserQuery{OrderBy: store.UserOrderCreatedAt, Limit: -1}, []string{"Carl", "Ann", "Bob"}},
+		{store.UserQuery{OrderBy: store.UserOrderCreatedAt, Descending: true, Limit: -1}, []string{"Bob", "Ann", "Carl"}},
+		{store.UserQuery{OrderBy: store.UserOrderCreatedAt, CreatedAfter: users[0].CreatedAt, Limit: -1}, []string{"Ann", "Bob"}},
+		{store.UserQuery{OrderBy: store.UserOrderCreatedAt, CreatedBefore: users[2].CreatedAt, Limit: -1}, []string{"Carl", "Ann"}},
+	}
+	for _, test := range tests {
+		page, err := s.ListUsers(ctx, test.query)
+		if err != nil {
+			t.Errorf("ListUsers(%+v): %v", test.query, err)
+			continue
+		}
+		if got := userNames(page.Users); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListUsers(%+v) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func testListUsersPages(t *testing.T, ctx context.Context, s store.Store) {
+	putUsers(t, ctx, s, "Eve", "Dan", "Cid", "Bob", "Ann")
+	for _, descending := range []bool{false, true} {
+		query := store.UserQuery{Descending: descending, Limit: 2}
+		var got []string
+		for pages := 0; ; pages++ {
+			if pages == 5 {
+				t.Fatalf("ListUsers(descending %v) never ends", descending)
+			}
+			page, err := s.ListUsers(ctx, query)
+			if err != nil {
+				t.Fatalf("ListUsers(%+v): %v", query, err)
+			}
+			got = append(got, userNames(page.Users)...)
+			if !page.More {
+				break
+			}
+			query.Start = page.End
+		}
+		want := []string{"Ann", "Bob", "Cid", "Dan", "Eve"}
+		if descending {
+			want = []string{"Eve", "Dan", "Cid", "Bob", "Ann"}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("pages of ListUsers(descending %v) = %v, want %v", descending, got, want)
+		}
+	}
+	if _, err := s.ListUsers(ctx, store.UserQuery{Start: "not a cursor", Limit: 2}); err != store.ErrInvalidQuery {
+		t.Errorf("ListUsers with a malformed cursor: %v, want %v", err, store.ErrInvalidQuery)
+	}
+}
+
+func testPostsRoundTrip(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Banner")[0]
+	post := putPosts(t, ctx, s, user.ID, "Hi!")[0]
+	got, err := s.GetPost(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("GetPost: %v", err)
+	}
+	if got.ID != post.ID || got.UserID != user.ID || got.Content != "Hi!" || !got.CreatedAt.Equal(post.CreatedAt) || !got.UpdatedAt.Equal(post.UpdatedAt) {
+		t.Errorf("GetPost = %+v, want %+v", *got, post)
+	}
+
+	got.Content, got.UpdatedAt = "Hello!", post.UpdatedAt.Add(time.Hour)
+	if err := s.PutPost(ctx, got); err != nil {
+		t.Fatalf("PutPost of an existing post: %v", err)
+	}
+	if edited, err := s.GetPost(ctx, post.ID); err != nil || edited.Content != "Hello!" || !edited.UpdatedAt.Equal(got.UpdatedAt) {
+		t.Errorf("GetPost after edit = %+v, %v, want Hello!", edited, err)
+	}
+
+	if err := s.DeletePost(ctx, post.ID); err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	if _, err := s.GetPost(ctx, post.ID); err != store.ErrNotFound {
+		t.Errorf("GetPost of a deleted post: %v, want %v", err, store.ErrNotFound)
+	}
+}
+
+func testListPostsOfAUser(t *testing.T, ctx context.Context, s store.Store) {
+	users := putUsers(t, ctx, s, "Ann", "Bob")
+	ann := putPosts(t, ctx, s, users[0].ID, "a1", "a2", "a3")
+	putPosts(t, ctx, s, users[1].ID, "b1", "b2")
+	tests := []struct {
+		query store.PostQuery
+		want  []string
+	}{
+		{store.PostQuery{Descending: true, Limit: -1}, []string{"a3", "b2", "a2", "b1", "a1"}},
+		{store.PostQuery{UserID: users[0].ID, Limit: -1}, []string{"a1", "a2", "a3"}},
+		{store.PostQuery{UserID: users[0].ID, Descending: true, Limit: -1}, []string{"a3", "a2", "a1"}},
+		{store.PostQuery{UserID: users[1].ID, Descending: true, Limit: 1}, []string{"b2"}},
+		{store.PostQuery{UserID: users[0].ID, CreatedAfter: ann[0].CreatedAt, Limit: -1}, []string{"a2", "a3"}},
+		{store.PostQuery{UserID: users[0].ID, CreatedBefore: ann[2].CreatedAt, Limit: -1}, []string{"a1", "a2"}},
+		{store.PostQuery{UserID: missingID(users[0].ID, users[1].ID, ann[2].ID), Limit: -1}, []string{}},
+	}
+	for _, test := range tests {
+		page, err := s.ListPosts(ctx, test.query)
+		if err != nil {
+			t.Errorf("ListPosts(%+v): %v", test.query, err)
+			continue
+		}
+		if got := postContents(page.Posts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListPosts(%+v) = %v, want %v", test.query, got, test.want)
+		}
+		count, err := s.CountPosts(ctx, test.query)
+		if want := len(test.want); test.query.Limit < 0 && (err != nil || count != want) {
+			t.Errorf("CountPosts(%+v) = %d, %v, want %d", test.query, count, err, want)
+		}
+	}
+	if count, err := s.CountPosts(ctx, store.PostQuery{UserID: users[1].ID, Limit: 1}); err != nil || count != 2 {
+		t.Errorf("CountPosts ignoring the page = %d, %v, want 2", count, err)
+	}
+}
+
+func testListPostsByUpdateTime(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Ann")[0]
+	posts := putPosts(t, ctx, s, user.ID, "first", "second", "third")
+	edited := posts[0]
+	edited.UpdatedAt = base.Add(time.Hour)
+	if err := s.PutPost(ctx, &edited); err != nil {
+		t.Fatalf("PutPost: %v", err)
+	}
+	tests := []struct {
+		query store.PostQuery
+		want  []string
+	}{
+		{store.PostQuery{OrderBy: store.PostOrderUpdatedAt, Descending: true, Limit: -1}, []string{"first", "third", "second"}},
+		{store.PostQuery{UserID: user.ID, OrderBy: store.PostOrderUpdatedAt, Limit: -1}, []string{"second", "third", "first"}},
+		{store.PostQuery{OrderBy: store.PostOrderUpdatedAt, UpdatedAfter: posts[2].UpdatedAt, Limit: -1}, []string{"first"}},
+		{store.PostQuery{OrderBy: store.PostOrderUpdatedAt, UpdatedBefore: posts[2].UpdatedAt, Limit: -1}, []string{"second"}},
+	}
+	for _, test := range tests {
+		page, err := s.ListPosts(ctx, test.query)
+		if err != nil {
+			t.Errorf("ListPosts(%+v): %v", test.query, err)
+			continue
+		}
+		if got := postContents(page.Posts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListPosts(%+v) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func testListPostsPages(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Ann")[0]
+	putPosts(t, ctx, s, user.ID, "p1", "p2", "p3", "p4", "p5")
+	for _, userID := range []string{"", user.ID} {
+		query := store.PostQuery{UserID: userID, Descending: true, Limit: 2}
+		var got []string
+		for pages := 0; ; pages++ {
+			if pages == 5 {
+				t.Fatalf("ListPosts(user %q) never ends", userID)
+			}
+			page, err := s.ListPosts(ctx, query)
+			if err != nil {
+				t.Fatalf("ListPosts(%+v): %v", query, err)
+			}
+			got = append(got, postContents(page.Posts)...)
+			if !page.More {
+				break
+			}
+			query.Start = page.End
+		}
+		if want := []string{"p5", "p4", "p3", "p2", "p1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("pages of ListPosts(user %q) = %v, want %v", userID, got, want)
+		}
+	}
+	page, err := s.ListPosts(ctx, store.PostQuery{Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListPosts with an offset: %v", err)
+	}
+	if got, want := postContents(page.Posts), []string{"p2", "p3"}; !reflect.DeepEqual(got, want) || !page.More {
+		t.Errorf("ListPosts with an offset = %v (more %v), want %v (more true)", got, page.More, want)
+	}
+}
+
+func testListPostsFromTiedPositions(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Ann")[0]
+	// three of the posts are tied at base, the lists order them by ID
+	var posts []m.Post
+	for _, minutes := range []int{-1, 0, 0, 0, 1} {
+		at := base.Add(time.Duration(minutes) * time.Minute)
+		post := &m.Post{UserID: user.ID, Content: at.String(), CreatedAt: at, UpdatedAt: at}
+		if err := s.PutPost(ctx, post); err != nil {
+			t.Fatalf("PutPost(%v): %v", at, err)
+		}
+		posts = append(posts, *post)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.Before(posts[j].CreatedAt)
+		}
+		a, _ := strconv.ParseInt(posts[i].ID, 10, 64)
+		b, _ := strconv.ParseInt(posts[j].ID, 10, 64)
+		return a < b
+	})
+	ids := func(posts []m.Post) []string {
+		ids := []string{}
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+		}
+		return ids
+	}
+	at := func(i int) *store.PostPosition {
+		return &store.PostPosition{SortKey: posts[i].CreatedAt, ID: posts[i].ID}
+	}
+
+	tests := []struct {
+		query    store.PostQuery
+		want     []m.Post
+		wantMore bool
+	}{
+		{store.PostQuery{After: at(1), Limit: -1}, posts[2:], false},
+		{store.PostQuery{After: at(2), Limit: -1}, posts[3:], false},
+		{store.PostQuery{Before: at(3), Limit: -1}, posts[:3], false},
+		{store.PostQuery{Before: at(2), Limit: -1}, posts[:2], false},
+		{store.PostQuery{After: at(1), Before: at(3), Limit: -1}, posts[2:3], false},
+		{store.PostQuery{UserID: user.ID, After: at(1), Limit: 1}, posts[2:3], true},
+		{store.PostQuery{After: at(1), Offset: 1, Limit: 1}, posts[3:4], true},
+		{store.PostQuery{Before: at(3), Limit: 3}, posts[:3], false}, // the posts past the page are left out too
+		{store.PostQuery{OrderBy: store.PostOrderUpdatedAt, After: at(2), Limit: -1}, posts[3:], false},
+	}
+	for _, test := range tests {
+		page, err := s.ListPosts(ctx, test.query)
+		if err != nil {
+			t.Errorf("ListPosts(%+v): %v", test.query, err)
+			continue
+		}
+		if got, want := ids(page.Posts), ids(test.want); !reflect.DeepEqual(got, want) || page.More != test.wantMore {
+			t.Errorf("ListPosts(%+v) = %v (more %v), want %v (more %v)", test.query, got, page.More, want, test.wantMore)
+		}
+	}
+}
+
+func testDeletePosts(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Ann")[0]
+	posts := putPosts(t, ctx, s, user.ID, "p1", "p2", "p3")
+	if err := s.DeletePosts(ctx, []string{posts[0].ID, posts[2].ID}); err != nil {
+		t.Fatalf("DeletePosts: %v", err)
+	}
+	page, err := s.ListPosts(ctx, store.PostQuery{UserID: user.ID, Limit: -1})
+	if err != nil {
+		t.Fatalf("ListPosts: %v", err)
+	}
+	if got, want := postContents(page.Posts), []string{"p2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("posts left by DeletePosts = %v, want %v", got, want)
+	}
+	if err := s.DeletePosts(ctx, nil); err != nil {
+		t.Errorf("DeletePosts(nil): %v", err)
+	}
+}
+
+func testDeletePostsFullBatch(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Ann")[0]
+	contents := make([]string, store.MaxBatchSize+1)
+	for i := range contents {
+		contents[i] = "p" + strconv.Itoa(i)
+	}
+	posts := putPosts(t, ctx, s, user.ID, contents...)
+	ids := make([]string, store.MaxBatchSize)
+	for i := range ids {
+		ids[i] = posts[i].ID
+	}
+	if err := s.DeletePosts(ctx, ids); err != nil {
+		t.Fatalf("DeletePosts of %d posts: %v", len(ids), err)
+	}
+	page, err := s.ListPosts(ctx, store.PostQuery{UserID: user.ID, Limit: -1})
+	if err != nil {
+		t.Fatalf("ListPosts: %v", err)
+	}
+	if got, want := postContents(page.Posts), contents[store.MaxBatchSize:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("posts left by DeletePosts = %v, want %v", got, want)
+	}
+}
+
+func testTransactionCommits(t *testing.T, ctx context.Context, s store.Store) {
+	var user m.User
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		user = m.User{Name: "Ann", CreatedAt: base}
+		if err := s.PutUser(ctx, &user); err != nil {
+			return err
+		}
+		return s.PutPost(ctx, &m.Post{UserID: user.ID, Content: "Hi!", CreatedAt: base, UpdatedAt: base})
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction: %v", err)
+	}
+	if _, err := s.GetUser(ctx, user.ID); err != nil {
+		t.Errorf("GetUser after commit: %v", err)
+	}
+	if count, err := s.CountPosts(ctx, store.PostQuery{UserID: user.ID}); err != nil || count != 1 {
+		t.Errorf("CountPosts after commit = %d, %v, want 1", count, err)
+	}
+}
+
+func testTransactionRollsBack(t *testing.T, ctx context.Context, s store.Store) {
+	user := putUsers(t, ctx, s, "Ann")[0]
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		renamed := user
+		renamed.Name = "Bob"
+		if err := s.PutUser(ctx, &renamed); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatalf("RunInTransaction: %v, want %v", err, errRollback)
+	}
+	if got, err := s.GetUser(ctx, user.ID); err != nil || got.Name != "Ann" {
+		t.Errorf("GetUser after rollback = %+v, %v, want Ann", got, err)
+	}
+}
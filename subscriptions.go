@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/complexity"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/loaders"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/middleware"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/resolvers"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// graphQLTransportWS is the WebSocket subprotocol subscriptions are served with,
+// see https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const graphQLTransportWS = "graphql-transport-ws"
+
+const (
+	connectionInitTimeout = 10 * time.Second // time a client has to send connection_init
+	keepAliveInterval     = 30 * time.Second // time between the pings keeping idle connections open through proxies
+)
+
+// Close codes of the graphql-transport-ws protocol
+const (
+	closeBadRequest         = 4400
+	closeUnauthorized       = 4401
+	closeForbidden          = 4403
+	closeInitTimeout        = 4408
+	closeSubscriberExists   = 4409
+	closeTooManyInitRequest = 4429
+	closeTooManyOperations  = 4429 // the protocol has no code of its own for it
+)
+
+func init() {
+	muxRouter.Handle("/graphql/ws", websocket.Server{
+		Handshake: selectTransportWS, // tokens travel in connection_init rather than cookies, so any origin may connect
+		Handler:   subscriptionsHandler,
+	})
+}
+
+// wsMessage is a message of the graphql-transport-ws protocol
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConnection is the state of a WebSocket connection serving subscriptions
+type wsConnection struct {
+	ws  *websocket.Conn
+	ctx context.Context // carries the backend and, once initialised, the viewer
+
+	writeMu sync.Mutex // serializes the messages of the operations
+	closed  bool       // set once the close frame is written
+
+	mu          sync.Mutex
+	initialised bool
+	acked       bool
+	operations  map[string]context.CancelFunc // by operation id
+}
+
+// selectTransportWS accepts the handshakes offering the graphql-transport-ws subprotocol
+func selectTransportWS(config *websocket.Config, r *http.Request) error {
+	for _, protocol := range config.Protocol {
+		if protocol == graphQLTransportWS {
+			config.Protocol = []string{graphQLTransportWS}
+			return nil
+		}
+	}
+	return errors.Errorf("Only the %s subprotocol is supported", graphQLTransportWS)
+}
+
+// subscriptionsHandler serves the operations of a graphql-transport-ws connection until it closes
+func subscriptionsHandler(ws *websocket.Conn) {
+	ctx, cancel := context.WithCancel(dataBackend.requestContext(ws.Request()))
+	defer cancel() // stops the operations of the connection
+	c := &wsConnection{ws: ws, ctx: ctx, operations: map[string]context.CancelFunc{}}
+
+	ws.SetReadDeadline(time.Now().Add(connectionInitTimeout))
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				c.close(closeInitTimeout, "Connection initialisation timeout")
+			}
+			return
+		}
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.close(closeBadRequest, "Invalid message received")
+			return
+		}
+		if code, reason := c.handle(msg); code != 0 {
+			c.close(code, reason)
+			return
+		}
+	}
+}
+
+// handle processes a message of the client, and returns the close code and reason
+// of the protocol violations that end the connection
+func (c *wsConnection) handle(msg wsMessage) (int, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch msg.Type {
+	case "connection_init":
+		if c.initialised {
+			return closeTooManyInitRequest, "Too many initialisation requests"
+		}
+		c.initialised = true
+		var payload struct {
+			Authorization string `json:"Authorization"` // browsers cannot set headers on WebSockets
+		}
+		if len(msg.Payload) > 0 && json.Unmarshal(msg.Payload, &payload) != nil {
+			return closeBadRequest, "Invalid connection_init payload"
+		}
+		if payload.Authorization == "" {
+			payload.Authorization = c.ws.Request().Header.Get("Authorization")
+		}
+		viewer, err := tokenSigner.ViewerFromAuthorization(payload.Authorization)
+		if err != nil {
+			return closeForbidden, "Forbidden"
+		}
+		c.ctx = auth.NewSignerContext(auth.NewContext(c.ctx, viewer), tokenSigner)
+		c.acked = true
+		c.ws.SetReadDeadline(time.Time{})
+		c.send(wsMessage{Type: "connection_ack"})
+		go c.keepAlive()
+	case "ping":
+		c.send(wsMessage{Type: "pong"})
+	case "pong":
+	case "subscribe":
+		if !c.acked {
+			return closeUnauthorized, "Unauthorized"
+		}
+		var request middleware.GraphQLRequest
+		if msg.ID == "" || json.Unmarshal(msg.Payload, &request) != nil {
+			return closeBadRequest, "Invalid subscribe message"
+		}
+		if _, ok := c.operations[msg.ID]; ok {
+			return closeSubscriberExists, "Subscriber for " + msg.ID + " already exists"
+		}
+		if maxConnectionOperations > 0 && len(c.operations) >= maxConnectionOperations {
+			return closeTooManyOperations, "Too many operations"
+		}
+		ctx, cancel := context.WithCancel(c.ctx)
+		c.operations[msg.ID] = cancel
+		go c.run(ctx, msg.ID, request)
+	case "complete":
+		if cancel, ok := c.operations[msg.ID]; ok {
+			cancel()
+			delete(c.operations, msg.ID)
+		}
+	default:
+		return closeBadRequest, "Invalid message type " + msg.Type
+	}
+	return 0, ""
+}
+
+// run executes the operation id, a query or mutation once and a subscription for every event of its field
+func (c *wsConnection) run(ctx context.Context, id string, request middleware.GraphQLRequest) {
+	if err := admitRequest(ctx, &request); err != nil {
+		_, formatted := admissionError(err)
+		c.finish(ctx, id, &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}})
+		return
+	}
+	params := graphql.Params{
+		Schema:         schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        loaders.NewContext(ctx, loaders.New()),
+	}
+	operation, measure, result := parseOperation(request)
+	if result != nil {
+		c.finish(ctx, id, result)
+		return
+	}
+	if operation.Operation != ast.OperationTypeSubscription {
+		result := doGraphQL(params)
+		result.Extensions = complexityExtensions(measure)
+		c.finish(ctx, id, result)
+		return
+	}
+	field, result := subscriptionField(operation)
+	if result != nil {
+		c.finish(ctx, id, result)
+		return
+	}
+	if result := checkSubscription(params); result != nil {
+		c.finish(ctx, id, result)
+		return
+	}
+	result = streamSubscription(ctx, params, field, "", func(event pubsub.Event, result *graphql.Result) {
+		c.send(wsMessage{ID: id, Type: "next", Payload: marshalPayload(result)})
+	})
+	if result != nil {
+		c.finish(ctx, id, result)
+	}
+}
+
+// finish ends the operation id with its last result, unless the client completed it already.
+// Results without data never ran and end with an error message.
+func (c *wsConnection) finish(ctx context.Context, id string, result *graphql.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	c.operations[id]()
+	delete(c.operations, id)
+	middleware.FormatResult(result)
+	if result.Data == nil {
+		c.send(wsMessage{ID: id, Type: "error", Payload: marshalPayload(result.Errors)})
+		return
+	}
+	c.send(wsMessage{ID: id, Type: "next", Payload: marshalPayload(result)})
+	c.send(wsMessage{ID: id, Type: "complete"})
+}
+
+// keepAlive pings the client until the connection closes
+func (c *wsConnection) keepAlive() {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.send(wsMessage{Type: "ping"})
+		}
+	}
+}
+
+// send writes msg, failures surface as the connection closing
+func (c *wsConnection) send(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.closed {
+		websocket.JSON.Send(c.ws, msg)
+	}
+}
+
+// close writes a close frame with a code of the protocol, the connection is closed once the handler returns
+func (c *wsConnection) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	frame := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(frame, uint16(code))
+	c.ws.PayloadType = websocket.CloseFrame
+	c.ws.Write(append(frame, reason...))
+}
+
+// marshalPayload function
+func marshalPayload(payload interface{}) json.RawMessage {
+	raw, _ := json.Marshal(payload)
+	return raw
+}
+
+// parseOperation returns the operation request selects and its measure, or the result reporting
+// why the document cannot run, which includes operations over the depth and cost limits
+func parseOperation(request middleware.GraphQLRequest) (*ast.OperationDefinition, complexity.Measure, *graphql.Result) {
+	document, err := parser.Parse(parser.ParseParams{Source: request.Query})
+	if err != nil {
+		return nil, complexity.Measure{}, &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if validation := graphql.ValidateDocument(&schema, document, nil); !validation.IsValid {
+		return nil, complexity.Measure{}, &graphql.Result{Errors: validation.Errors}
+	}
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		candidate, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if request.OperationName == "" && operation != nil {
+			return nil, complexity.Measure{}, badOperation("Must provide operation name if query contains multiple operations")
+		}
+		if request.OperationName == "" || (candidate.Name != nil && candidate.Name.Value == request.OperationName) {
+			operation = candidate
+		}
+	}
+	if operation == nil {
+		return nil, complexity.Measure{}, badOperation("Unknown operation named \"" + request.OperationName + "\"")
+	}
+	measure := complexity.Of(&schema, document, operation, request.Variables, fieldCosts)
+	return operation, measure, checkLimits(measure)
+}
+
+// subscriptionField returns the single root field a subscription selects, the event topic it listens to
+func subscriptionField(operation *ast.OperationDefinition) (*ast.Field, *graphql.Result) {
+	var selections []ast.Selection
+	if operation.SelectionSet != nil {
+		selections = operation.SelectionSet.Selections
+	}
+	if len(selections) != 1 {
+		return nil, badOperation("Subscriptions must select exactly one top level field")
+	}
+	field, ok := selections[0].(*ast.Field)
+	if !ok || strings.HasPrefix(field.Name.Value, "__") {
+		return nil, badOperation("Subscriptions must select one of the fields of RootSubscription")
+	}
+	return field, nil
+}
+
+// checkSubscription runs a subscription without an event, to report bad arguments before waiting for events
+func checkSubscription(params graphql.Params) *graphql.Result {
+	if result := doGraphQL(params); result.HasErrors() {
+		return result
+	}
+	return nil
+}
+
+// streamSubscription calls send with the result of the subscription for every event of field,
+// from the one following the event lastEventID when the broker still holds it, until ctx is
+// done. It returns the result that ended the subscription early, nil when ctx ended it.
+func streamSubscription(ctx context.Context, params graphql.Params, field *ast.Field, lastEventID string, send func(pubsub.Event, *graphql.Result)) *graphql.Result {
+	events, err := pubsub.FromContext(ctx).Subscribe(ctx, field.Name.Value, lastEventID)
+	if err != nil {
+		log.Printf("Failed to subscribe to %s: %v", field.Name.Value, err)
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{middleware.FormatRequestError("Failed to subscribe", http.StatusInternalServerError)}}
+	}
+	responseKey := field.Name.Value
+	if field.Alias != nil {
+		responseKey = field.Alias.Value
+	}
+	for event := range events {
+		params.Context = loaders.NewContext(ctx, loaders.New()) // every event reads fresh data
+		params.RootObject = map[string]interface{}{resolvers.EventRootKey: event}
+		result := doGraphQL(params)
+		if data, _ := result.Data.(map[string]interface{}); !result.HasErrors() && data[responseKey] == nil {
+			continue // filtered out by the arguments
+		}
+		middleware.FormatResult(result)
+		send(event, result)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	// the broker dropped a subscriber that fell behind
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{middleware.FormatRequestError("Too many events were missed, subscribe again", http.StatusInternalServerError)}}
+}
+
+// badOperation returns the result of an operation that cannot run
+func badOperation(message string) *graphql.Result {
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{middleware.FormatRequestError(message, http.StatusBadRequest)}}
+}
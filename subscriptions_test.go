@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/auth"
+	m "github.com/damilarelana/goGraphQLGoogleAppEngine/models"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+)
+
+// wsClient speaks graphql-transport-ws over a raw connection, as x/net/websocket hides close codes
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// wsFrame is a frame the server sent, code is set for close frames
+type wsFrame struct {
+	msg  wsMessage
+	code int
+}
+
+// dialWS opens a graphql-transport-ws connection to server
+func dialWS(t *testing.T, server *httptest.Server) *wsClient {
+	t.Helper()
+	host := strings.TrimPrefix(server.URL, "http://")
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /graphql/ws HTTP/1.1\r\nHost: "+host+"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Protocol: "+graphQLTransportWS+"\r\nOrigin: "+server.URL+"\r\n\r\n")
+	c := &wsClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	status, err := c.r.ReadString('\n')
+	if err != nil || !strings.Contains(status, " 101 ") {
+		t.Fatalf("handshake = %q, %v, want 101", status, err)
+	}
+	for line := status; line != "\r\n"; {
+		if line, err = c.r.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// send writes msg as a masked text frame, as clients must
+func (c *wsClient) send(msg wsMessage) {
+	c.t.Helper()
+	payload, _ := json.Marshal(msg)
+	frame := []byte{0x81}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns the next text or close frame of the server
+func (c *wsClient) read() wsFrame {
+	c.t.Helper()
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			c.t.Fatalf("reading a frame: %v", err)
+		}
+		length := int(header[1] & 0x7f)
+		switch length {
+		case 126:
+			extended := make([]byte, 2)
+			io.ReadFull(c.r, extended)
+			length = int(binary.BigEndian.Uint16(extended))
+		case 127:
+			extended := make([]byte, 8)
+			io.ReadFull(c.r, extended)
+			length = int(binary.BigEndian.Uint64(extended))
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			c.t.Fatalf("reading a frame: %v", err)
+		}
+		switch header[0] & 0x0f {
+		case 0x8:
+			return wsFrame{code: int(binary.BigEndian.Uint16(payload))}
+		case 0x1:
+			var frame wsFrame
+			if err := json.Unmarshal(payload, &frame.msg); err != nil {
+				c.t.Fatalf("decoding %s: %v", payload, err)
+			}
+			if frame.msg.Type == "ping" {
+				continue
+			}
+			return frame
+		}
+	}
+}
+
+// init sends connection_init with the token of viewer, if any, and waits for connection_ack
+func (c *wsClient) init(viewer auth.Viewer) {
+	c.t.Helper()
+	init := wsMessage{Type: "connection_init"}
+	if token := tokenFor(viewer); token != "" {
+		init.Payload, _ = json.Marshal(map[string]string{"Authorization": "Bearer " + token})
+	}
+	c.send(init)
+	if frame := c.read(); frame.msg.Type != "connection_ack" {
+		c.t.Fatalf("answer to connection_init = %+v, want connection_ack", frame)
+	}
+}
+
+// subscribe starts the operation id running query
+func (c *wsClient) subscribe(id, query string) {
+	payload, _ := json.Marshal(map[string]string{"query": query})
+	c.send(wsMessage{ID: id, Type: "subscribe", Payload: payload})
+}
+
+// expectClose reads frames until the server closes the connection, and checks its code
+func (c *wsClient) expectClose(code int) {
+	c.t.Helper()
+	for {
+		frame := c.read()
+		if frame.code == 0 {
+			continue
+		}
+		if frame.code != code {
+			c.t.Errorf("close code = %d, want %d", frame.code, code)
+		}
+		return
+	}
+}
+
+func TestSubscriptionsOverWebSocket(t *testing.T) {
+	server := newTestServer(t)
+	seedUser(t, "Ann")
+	const postCreated = `subscription { postCreated { content } }`
+
+	t.Run("query", func(t *testing.T) {
+		c := dialWS(t, server)
+		c.init(auth.Viewer{})
+		c.subscribe("1", `{ users(first: 1) { nodes { name } } }`)
+		if frame := c.read(); frame.msg.ID != "1" || frame.msg.Type != "next" || !strings.Contains(string(frame.msg.Payload), `"name":"Ann"`) {
+			t.Errorf("first message = %+v, want the users", frame)
+		}
+		if frame := c.read(); frame.msg.ID != "1" || frame.msg.Type != "complete" {
+			t.Errorf("second message = %+v, want complete", frame)
+		}
+	})
+
+	t.Run("subscription", func(t *testing.T) {
+		c := dialWS(t, server)
+		c.init(auth.Viewer{})
+		c.subscribe("s", postCreated)
+		done := make(chan struct{})
+		go func() { // the subscription starts listening in the background, publish until it hears
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					dataBackend.broker.Publish(context.Background(), pubsub.Event{Topic: pubsub.PostCreated, Post: m.Post{Content: "Hi!"}})
+				}
+			}
+		}()
+		frame := c.read()
+		close(done)
+		if frame.msg.ID != "s" || frame.msg.Type != "next" || !strings.Contains(string(frame.msg.Payload), `"content":"Hi!"`) {
+			t.Errorf("message = %+v, want the new post", frame)
+		}
+		c.send(wsMessage{ID: "s", Type: "complete"})
+		c.subscribe("s", `{ users(first: 1) { nodes { name } } }`) // the id is free again
+		for frame = c.read(); frame.msg.Type == "next" && frame.msg.ID == "s" && strings.Contains(string(frame.msg.Payload), "content"); frame = c.read() {
+		} // events published before the subscription stopped
+		if frame.msg.ID != "s" || frame.msg.Type != "next" || !strings.Contains(string(frame.msg.Payload), `"name":"Ann"`) {
+			t.Errorf("message after reusing the id = %+v, want the users", frame)
+		}
+	})
+
+	t.Run("forbidden token", func(t *testing.T) {
+		c := dialWS(t, server)
+		payload, _ := json.Marshal(map[string]string{"Authorization": "Bearer forged"})
+		c.send(wsMessage{Type: "connection_init", Payload: payload})
+		c.expectClose(closeForbidden)
+	})
+
+	t.Run("subscribe before connection_ack", func(t *testing.T) {
+		c := dialWS(t, server)
+		c.subscribe("1", postCreated)
+		c.expectClose(closeUnauthorized)
+	})
+
+	t.Run("duplicate id", func(t *testing.T) {
+		c := dialWS(t, server)
+		c.init(auth.Viewer{})
+		c.subscribe("1", postCreated)
+		c.subscribe("1", postCreated)
+		c.expectClose(closeSubscriberExists)
+	})
+
+	t.Run("too many operations", func(t *testing.T) {
+		defer func(limit int) { maxConnectionOperations = limit }(maxConnectionOperations)
+		maxConnectionOperations = 2
+		c := dialWS(t, server)
+		c.init(auth.Viewer{})
+		c.subscribe("1", postCreated)
+		c.subscribe("2", postCreated)
+		c.subscribe("3", postCreated)
+		c.expectClose(closeTooManyOperations)
+	})
+}
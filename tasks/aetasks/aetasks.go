@@ -0,0 +1,33 @@
+package aetasks
+
+import (
+	"context"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search/aesearch"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store/aedatastore"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/tasks"
+	"google.golang.org/appengine/delay"
+)
+
+// run is pushed onto the default App Engine task queue, which retries it until it succeeds
+var run = delay.Func("tasks", func(ctx context.Context, name, arg string) error {
+	ctx = search.NewContext(store.NewContext(ctx, aedatastore.New()), aesearch.New())
+	ctx = pubsub.NewContext(ctx, pubsub.Discard{}) // subscribers are connected to other instances, if any
+	return tasks.Run(tasks.NewContext(ctx, New()), name, arg)
+})
+
+// Queue runs tasks on the App Engine task queue, with the App Engine datastore and search index
+type Queue struct{}
+
+// New function
+func New() Queue {
+	return Queue{}
+}
+
+// Enqueue function
+func (Queue) Enqueue(ctx context.Context, name, arg string) error {
+	return run.Call(ctx, name, arg)
+}
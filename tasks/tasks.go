@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/pubsub"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/search"
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/store"
+)
+
+// Func is a background task. It receives a context carrying the store, the
+// queue, the search index and the broker, and must be safe to run again after a failure.
+type Func func(ctx context.Context, arg string) error
+
+// registry maps task names onto their functions
+var registry = map[string]Func{}
+
+// Register makes fn available to queues under name, it must be called from an init function
+func Register(name string, fn Func) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("tasks: %q registered twice", name))
+	}
+	registry[name] = fn
+}
+
+// Registered reports whether a task is registered under name
+func Registered(name string) bool {
+	_, ok := registry[name]
+	return ok
+}
+
+// Run runs the task registered under name
+func Run(ctx context.Context, name, arg string) error {
+	fn, ok := registry[name]
+	if !ok {
+		return fmt.Errorf("tasks: unknown task %q", name)
+	}
+	return fn(ctx, arg)
+}
+
+// Queue runs tasks after the request that enqueued them has returned
+type Queue interface {
+	Enqueue(ctx context.Context, name, arg string) error
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying q
+func NewContext(ctx context.Context, q Queue) context.Context {
+	return context.WithValue(ctx, contextKey{}, q)
+}
+
+// FromContext returns the Queue carried by ctx
+func FromContext(ctx context.Context) Queue {
+	q, ok := ctx.Value(contextKey{}).(Queue)
+	if !ok {
+		panic("tasks: no Queue in context")
+	}
+	return q
+}
+
+// Local runs tasks on goroutines of the current process, retrying failures a
+// few times. Tasks that are still running are lost when the process exits.
+type Local struct{}
+
+// attempts is the number of times Local runs a failing task
+const attempts = 3
+
+// Enqueue function
+func (Local) Enqueue(ctx context.Context, name, arg string) error {
+	if !Registered(name) {
+		return fmt.Errorf("tasks: unknown task %q", name)
+	}
+	background := search.NewContext(store.NewContext(context.Background(), store.FromContext(ctx)), search.FromContext(ctx))
+	background = pubsub.NewContext(background, pubsub.FromContext(ctx))
+	ctx = NewContext(background, Local{}) // outlive the request
+	go func() {
+		for attempt := 1; ; attempt++ {
+			err := Run(ctx, name, arg)
+			if err == nil {
+				return
+			}
+			if attempt == attempts {
+				log.Printf("tasks: %s(%q) failed: %v", name, arg, err)
+				return
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,92 @@
+package validate
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/damilarelana/goGraphQLGoogleAppEngine/apperrors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxIndexedBytes is the largest string the datastore accepts in an indexed property
+const MaxIndexedBytes = 1500
+
+// Rules struct describes how a string argument is cleaned and checked
+type Rules struct {
+	Trim          bool // strip leading and trailing white space
+	Normalize     bool // convert to Unicode normalization form NFC
+	MinLength     int  // minimum number of characters, after trimming
+	MaxLength     int  // maximum number of characters, 0 for no limit
+	MaxBytes      int  // maximum UTF-8 encoded size, 0 for no limit
+	AllowNewlines bool // accept line breaks and tabs among the control characters
+}
+
+// UserName rules apply to the `name` of users, which is indexed
+var UserName = Rules{
+	Trim:      true,
+	Normalize: true,
+	MinLength: 1,
+	MaxLength: 100,
+	MaxBytes:  MaxIndexedBytes,
+}
+
+// PostContent rules apply to the `content` of posts, which is stored unindexed
+var PostContent = Rules{
+	Trim:          true,
+	Normalize:     true,
+	MinLength:     1,
+	MaxLength:     10000,
+	AllowNewlines: true,
+}
+
+// Clean returns value cleaned according to the rules, or an InvalidArgument error about field
+func (r Rules) Clean(field, value string) (string, error) {
+	if !utf8.ValidString(value) {
+		return "", apperrors.InvalidArgumentf("%s is not valid UTF-8", field).OnField(field)
+	}
+	if r.Normalize {
+		value = norm.NFC.String(value)
+	}
+	value = stripFormat(value)
+	if r.Trim {
+		value = strings.TrimSpace(value)
+	}
+	for _, c := range value {
+		if !unicode.IsControl(c) || (r.AllowNewlines && (c == '\n' || c == '\r' || c == '\t')) {
+			continue
+		}
+		return "", apperrors.InvalidArgumentf("%s must not contain control characters such as %U", field, c).OnField(field)
+	}
+
+	length := utf8.RuneCountInString(value)
+	switch {
+	case length == 0 && r.MinLength > 0:
+		return "", apperrors.InvalidArgumentf("%s must not be blank", field).OnField(field)
+	case length < r.MinLength:
+		return "", apperrors.InvalidArgumentf("%s must be at least %d characters long", field, r.MinLength).OnField(field)
+	case r.MaxLength > 0 && length > r.MaxLength:
+		return "", apperrors.InvalidArgumentf("%s must be at most %d characters long", field, r.MaxLength).OnField(field)
+	case r.MaxBytes > 0 && len(value) > r.MaxBytes:
+		return "", apperrors.InvalidArgumentf("%s must be at most %d bytes long", field, r.MaxBytes).OnField(field)
+	}
+	return value, nil
+}
+
+// stripFormat function removes the invisible format characters of value, such as zero width spaces
+// and bidi overrides, which would let a blank or spoofed string through. Zero width joiners and
+// non-joiners are kept between two visible characters, where they shape emoji and some scripts.
+func stripFormat(value string) string {
+	runes := []rune(value)
+	visible := func(i int) bool {
+		return i >= 0 && i < len(runes) && !unicode.Is(unicode.Cf, runes[i]) && !unicode.IsSpace(runes[i]) && !unicode.IsControl(runes[i])
+	}
+	kept := runes[:0:0]
+	for i, c := range runes {
+		if unicode.Is(unicode.Cf, c) && !((c == '\u200c' || c == '\u200d') && visible(i-1) && visible(i+1)) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return string(kept)
+}